@@ -0,0 +1,308 @@
+//go:build integration
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+	"github.com/uptrace/bun"
+
+	"github.com/determined-ai/determined/master/pkg/model"
+	"github.com/determined-ai/determined/proto/pkg/apiv1"
+	"github.com/determined-ai/determined/proto/pkg/trialv1"
+)
+
+// These tests exercise Postgres-specific SQL (rollback archival, the setTrialBestValidation CTE,
+// the ->/->> operators in FilterTrials) that a mock connection can't validate. They're gated
+// behind the "integration" build tag and run in their own CI job so the unit test suite run on
+// every PR stays fast and doesn't need Docker.
+//
+// DET_INTEGRATION_POSTGRES_URL, when set, points the suite at an already-running Postgres
+// instance (the convention CI uses, mirroring how other storage integration suites in this repo
+// pick up a *_STORAGE_TEST_DSN env var). Locally, with Docker available and no DSN set, the suite
+// starts its own postgres container via testcontainers-go.
+
+func setupIntegrationDB(t *testing.T) *PgDB {
+	t.Helper()
+
+	url := os.Getenv("DET_INTEGRATION_POSTGRES_URL")
+	if url == "" {
+		url = startTestPostgres(t)
+	}
+
+	require.NoError(t, Migrate(url, "file://../../static/migrations"))
+
+	pg, err := Connect(url)
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, pg.Close()) })
+
+	return pg
+}
+
+func startTestPostgres(t *testing.T) string {
+	t.Helper()
+	ctx := context.Background()
+
+	req := testcontainers.ContainerRequest{
+		Image:        "postgres:10",
+		ExposedPorts: []string{"5432/tcp"},
+		Env: map[string]string{
+			"POSTGRES_DB":       "determined",
+			"POSTGRES_PASSWORD": "postgres",
+		},
+		WaitingFor: wait.ForListeningPort("5432/tcp").WithStartupTimeout(60 * time.Second),
+	}
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: req,
+		Started:          true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, container.Terminate(ctx)) })
+
+	host, err := container.Host(ctx)
+	require.NoError(t, err)
+	port, err := container.MappedPort(ctx, "5432")
+	require.NoError(t, err)
+
+	return fmt.Sprintf("postgres://postgres:postgres@%s:%s/determined?sslmode=disable", host, port.Port())
+}
+
+// seedExperimentAndTrial inserts the minimal experiments/trials rows a test needs, returning the
+// new trial's ID.
+func seedExperimentAndTrial(t *testing.T, pg *PgDB, searcherConfig map[string]interface{}) int {
+	t.Helper()
+
+	var experimentID int
+	require.NoError(t, pg.sql.Get(&experimentID, `
+INSERT INTO experiments (state, config, model_definition, owner_id, project_id)
+VALUES ('ACTIVE', $1, '{}', 1, 1)
+RETURNING id
+`, model.JSONObj{"searcher": searcherConfig}))
+
+	trial := &model.Trial{
+		ExperimentID: experimentID,
+		State:        model.ActiveState,
+		StartTime:    time.Now().UTC(),
+		Hparams:      model.JSONObj{},
+	}
+	require.NoError(t, pg.AddTrial(trial))
+	return trial.ID
+}
+
+func TestIntegrationAddTrialRoundtrip(t *testing.T) {
+	pg := setupIntegrationDB(t)
+	trialID := seedExperimentAndTrial(t, pg, map[string]interface{}{"metric": "loss"})
+
+	got, err := pg.TrialByID(trialID)
+	require.NoError(t, err)
+	require.Equal(t, trialID, got.ID)
+	require.Equal(t, model.ActiveState, got.State)
+}
+
+func TestIntegrationUpdateTrialIllegalTransition(t *testing.T) {
+	pg := setupIntegrationDB(t)
+
+	cases := []struct {
+		name     string
+		from, to model.State
+		wantErr  bool
+	}{
+		{"active to completed is legal", model.ActiveState, model.CompletedState, false},
+		{"completed to active is illegal", model.CompletedState, model.ActiveState, true},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			trialID := seedExperimentAndTrial(t, pg, map[string]interface{}{"metric": "loss"})
+			require.NoError(t, pg.UpdateTrial(trialID, tc.from))
+
+			err := pg.UpdateTrial(trialID, tc.to)
+			if tc.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestIntegrationAddTrainingMetricsArchivesStaleRuns(t *testing.T) {
+	pg := setupIntegrationDB(t)
+	trialID := seedExperimentAndTrial(t, pg, map[string]interface{}{"metric": "loss"})
+
+	require.NoError(t, pg.AddTrainingMetrics(context.Background(), &trialv1.TrialMetrics{
+		TrialId:        int32(trialID),
+		TrialRunId:     0,
+		StepsCompleted: 100,
+		Metrics:        map[string]interface{}{"loss": 0.5},
+	}))
+
+	// A new run reporting at or before where the stale run 0 left off should archive run 0's row.
+	require.NoError(t, pg.UpdateTrialRunID(trialID, 1))
+	require.NoError(t, pg.AddTrainingMetrics(context.Background(), &trialv1.TrialMetrics{
+		TrialId:        int32(trialID),
+		TrialRunId:     1,
+		StepsCompleted: 100,
+		Metrics:        map[string]interface{}{"loss": 0.4},
+	}))
+
+	var archived bool
+	require.NoError(t, pg.sql.Get(&archived, `
+SELECT archived FROM raw_trial_metrics
+WHERE trial_id = $1 AND trial_run_id = 0 AND "group" = $2
+`, trialID, trainingMetricGroup))
+	require.True(t, archived, "run 0's training metrics should be archived once run 1 supersedes it")
+}
+
+func TestIntegrationAddValidationMetricsBestValidation(t *testing.T) {
+	cases := []struct {
+		name            string
+		smallerIsBetter bool
+		metrics         []float64
+		wantBestIdx     int
+	}{
+		{"smaller is better picks the minimum", true, []float64{0.9, 0.2, 0.5}, 1},
+		{"larger is better picks the maximum", false, []float64{0.9, 0.2, 0.5}, 0},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			pg := setupIntegrationDB(t)
+			trialID := seedExperimentAndTrial(t, pg, map[string]interface{}{
+				"metric":            "accuracy",
+				"smaller_is_better": tc.smallerIsBetter,
+			})
+
+			var bestValidationIDs []int
+			for i, v := range tc.metrics {
+				require.NoError(t, pg.AddValidationMetrics(context.Background(), &trialv1.TrialMetrics{
+					TrialId:        int32(trialID),
+					TrialRunId:     0,
+					StepsCompleted: int32(100 * (i + 1)),
+					Metrics:        map[string]interface{}{"accuracy": v},
+				}))
+
+				var bestID int
+				require.NoError(t, pg.sql.Get(&bestID, `
+SELECT best_validation_id FROM trials WHERE id = $1
+`, trialID))
+				bestValidationIDs = append(bestValidationIDs, bestID)
+			}
+
+			var gotBest float64
+			require.NoError(t, pg.sql.Get(&gotBest, `
+SELECT (metrics->'validation_metrics'->>'accuracy')::float8
+FROM raw_trial_metrics
+WHERE id = $1
+`, bestValidationIDs[len(bestValidationIDs)-1]))
+			require.Equal(t, tc.metrics[tc.wantBestIdx], gotBest)
+		})
+	}
+}
+
+func TestIntegrationAddValidationMetricsBestValidationWithExpression(t *testing.T) {
+	cases := []struct {
+		name            string
+		smallerIsBetter bool
+		losses          []float64
+		wantBestIdx     int
+	}{
+		{"smaller is better picks the minimum loss", true, []float64{0.9, 0.2, 0.5}, 1},
+		{"larger is better picks the maximum loss", false, []float64{0.9, 0.2, 0.5}, 0},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			pg := setupIntegrationDB(t)
+			trialID := seedExperimentAndTrial(t, pg, map[string]interface{}{
+				"metric_expression": "loss",
+				"smaller_is_better": tc.smallerIsBetter,
+			})
+
+			var bestValidationIDs []int
+			for i, v := range tc.losses {
+				require.NoError(t, pg.AddValidationMetrics(context.Background(), &trialv1.TrialMetrics{
+					TrialId:        int32(trialID),
+					TrialRunId:     0,
+					StepsCompleted: int32(100 * (i + 1)),
+					Metrics:        map[string]interface{}{"loss": v},
+				}))
+
+				var bestID int
+				require.NoError(t, pg.sql.Get(&bestID, `
+SELECT best_validation_id FROM trials WHERE id = $1
+`, trialID))
+				bestValidationIDs = append(bestValidationIDs, bestID)
+			}
+
+			var gotBest float64
+			require.NoError(t, pg.sql.Get(&gotBest, `
+SELECT (metrics->'validation_metrics'->>'loss')::float8
+FROM raw_trial_metrics
+WHERE id = $1
+`, bestValidationIDs[len(bestValidationIDs)-1]))
+			require.Equal(t, tc.losses[tc.wantBestIdx], gotBest,
+				"metric_expression best validation must respect smaller_is_better, not always maximize")
+		})
+	}
+}
+
+func TestIntegrationAddValidationMetricsUnknownExpressionMetric(t *testing.T) {
+	pg := setupIntegrationDB(t)
+	trialID := seedExperimentAndTrial(t, pg, map[string]interface{}{
+		"metric_expression": "accuracy", // typo'd: only "loss" is ever reported below.
+		"smaller_is_better": true,
+	})
+
+	err := pg.AddValidationMetrics(context.Background(), &trialv1.TrialMetrics{
+		TrialId:        int32(trialID),
+		TrialRunId:     0,
+		StepsCompleted: 100,
+		Metrics:        map[string]interface{}{"loss": 0.5},
+	})
+	require.Error(t, err, "an expression referencing a never-reported metric should be rejected, "+
+		"not silently leave best_validation_id unset")
+}
+
+func TestIntegrationAggregateTrialsNilFilters(t *testing.T) {
+	pg := setupIntegrationDB(t)
+	seedExperimentAndTrial(t, pg, map[string]interface{}{"metric": "loss"})
+
+	// A nil Filters is a reasonable way for a client to say "no filter"; it must not panic.
+	resp, err := pg.AggregateTrials(context.Background(), &apiv1.AggregateTrialsRequest{
+		Aggregations: []*apiv1.AggregateTrialsRequest_Aggregation{
+			{Func: apiv1.AggregateTrialsRequest_AGGREGATION_FUNC_COUNT},
+		},
+		Filters: nil,
+	})
+	require.NoError(t, err)
+	require.Len(t, resp.Results, 1)
+}
+
+func TestIntegrationFilterTrials(t *testing.T) {
+	pg := setupIntegrationDB(t)
+
+	matching := seedExperimentAndTrial(t, pg, map[string]interface{}{"metric": "loss"})
+	_ = seedExperimentAndTrial(t, pg, map[string]interface{}{"metric": "loss"})
+
+	q, err := pg.FilterTrials(pg.bun.NewSelect().Model((*TrialsAugmented)(nil)), &apiv1.QueryFilters{})
+	require.NoError(t, err)
+
+	selectQuery, ok := q.(*bun.SelectQuery)
+	require.True(t, ok)
+
+	var got []TrialsAugmented
+	require.NoError(t, selectQuery.Where("trial_id = ?", matching).Scan(context.Background(), &got))
+	require.Len(t, got, 1)
+	require.Equal(t, int32(matching), got[0].TrialID)
+}
@@ -2,7 +2,9 @@ package db
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
+	"regexp"
 	"strings"
 	"time"
 
@@ -155,7 +157,9 @@ WHERE id = $1`, id, restartCount); err != nil {
 	return nil
 }
 
-// AddTrainingMetrics adds a completed step to the database with the given training metrics.
+// AddTrainingMetrics adds a completed step to the database with the given training metrics. It
+// is a thin wrapper over the generic archive-then-insert path shared with AddTrialMetrics,
+// specialized only in that a training report also archives any now-stale validations.
 // If these training metrics occur before any others, a rollback is assumed and later
 // training and validation metrics are cleaned up.
 func (db *PgDB) AddTrainingMetrics(ctx context.Context, m *trialv1.TrialMetrics) error {
@@ -164,50 +168,28 @@ func (db *PgDB) AddTrainingMetrics(ctx context.Context, m *trialv1.TrialMetrics)
 			return err
 		}
 
-		if _, err := tx.ExecContext(ctx, `
-UPDATE raw_steps SET archived = true
-WHERE trial_id = $1
-  AND trial_run_id < $2
-  AND total_batches >= $3;
-`, m.TrialId, m.TrialRunId, m.StepsCompleted); err != nil {
-			return errors.Wrap(err, "archiving training metrics")
+		if err := archiveTrialMetrics(ctx, tx, trainingMetricGroup, m.TrialId, m.TrialRunId, m.StepsCompleted); err != nil {
+			return err
 		}
 
-		if _, err := tx.ExecContext(ctx, `
-UPDATE raw_validations SET archived = true
-WHERE trial_id = $1
-  AND trial_run_id < $2
-  AND total_batches > $3;
-`, m.TrialId, m.TrialRunId, m.StepsCompleted); err != nil {
-			return errors.Wrap(err, "archiving validations")
+		if err := archiveTrialMetricsCompare(
+			ctx, tx, validationMetricGroup, m.TrialId, m.TrialRunId, m.StepsCompleted, ">",
+		); err != nil {
+			return err
 		}
 
-		if _, err := tx.NamedExecContext(ctx, `
-INSERT INTO raw_steps
-	(trial_id, trial_run_id, state,
-	 end_time, metrics, total_batches)
-VALUES
-	(:trial_id, :trial_run_id, :state,
-	 now(), :metrics, :total_batches)
-`, model.TrialMetrics{
-			TrialID:    int(m.TrialId),
-			TrialRunID: int(m.TrialRunId),
-			State:      model.CompletedState,
-			Metrics: map[string]interface{}{
+		return insertTrialMetrics(ctx, tx, trainingMetricGroup, m.TrialId, m.TrialRunId, m.StepsCompleted,
+			map[string]interface{}{
 				"avg_metrics":   m.Metrics,
 				"batch_metrics": m.BatchMetrics,
-			},
-			TotalBatches: int(m.StepsCompleted),
-		}); err != nil {
-			return errors.Wrap(err, "inserting training metrics")
-		}
-		return nil
+			})
 	})
 }
 
 // AddValidationMetrics adds a completed validation to the database with the given
-// validation metrics. If these validation metrics occur before any others, a rollback
-// is assumed and later metrics are cleaned up from the database.
+// validation metrics, then recomputes the trial's best validation. It is a thin wrapper over the
+// generic archive-then-insert path shared with AddTrialMetrics. If these validation metrics
+// occur before any others, a rollback is assumed and later metrics are cleaned up.
 func (db *PgDB) AddValidationMetrics(
 	ctx context.Context, m *trialv1.TrialMetrics,
 ) error {
@@ -216,13 +198,8 @@ func (db *PgDB) AddValidationMetrics(
 			return err
 		}
 
-		if _, err := tx.ExecContext(ctx, `
-UPDATE raw_validations SET archived = true
-WHERE trial_id = $1
-  AND trial_run_id < $2
-  AND total_batches >= $2;
-`, m.TrialId, m.StepsCompleted); err != nil {
-			return errors.Wrap(err, "archiving validations")
+		if err := archiveTrialMetrics(ctx, tx, validationMetricGroup, m.TrialId, m.TrialRunId, m.StepsCompleted); err != nil {
+			return err
 		}
 
 		if err := db.ensureStep(
@@ -231,58 +208,46 @@ WHERE trial_id = $1
 			return err
 		}
 
-		if _, err := tx.NamedExecContext(ctx, `
-INSERT INTO raw_validations
-	(trial_id, trial_run_id, state, end_time,
-	 metrics, total_batches)
-VALUES
-	(:trial_id, :trial_run_id, :state, now(),
-	 :metrics, :total_batches)
-`, model.TrialMetrics{
-			TrialID:    int(m.TrialId),
-			TrialRunID: int(m.TrialRunId),
-			State:      model.CompletedState,
-			Metrics: map[string]interface{}{
-				"validation_metrics": m.Metrics,
-			},
-			TotalBatches: int(m.StepsCompleted),
-		}); err != nil {
-			return errors.Wrap(err, "inserting validation metrics")
-		}
-
-		if err := setTrialBestValidation(tx, int(m.TrialId)); err != nil {
-			return errors.Wrap(err, "updating trial best validation")
+		if err := insertTrialMetrics(ctx, tx, validationMetricGroup, m.TrialId, m.TrialRunId, m.StepsCompleted,
+			map[string]interface{}{"validation_metrics": m.Metrics}); err != nil {
+			return err
 		}
 
-		return nil
+		return errors.Wrap(
+			setTrialBestValidation(tx, int(m.TrialId), validationMetricGroup),
+			"updating trial best validation",
+		)
 	})
 }
 
-// ensureStep inserts a noop step if no step exists at the batch index of the validation.
-// This is used to make sure there is at least a dummy step for each validation or checkpoint,
-// in the event one comes without (e.g. perform_initial_validation).
+// ensureStep inserts a noop training-group row if none exists at the batch index of the
+// validation. This is used to make sure there is at least a dummy step for each validation or
+// checkpoint, in the event one comes without (e.g. perform_initial_validation).
 func (db *PgDB) ensureStep(
 	ctx context.Context, tx *sqlx.Tx, trialID, trialRunID, stepsCompleted int,
 ) error {
 	if _, err := tx.NamedExecContext(ctx, `
-INSERT INTO raw_steps
-	(trial_id, trial_run_id, state,
+INSERT INTO raw_trial_metrics
+	(trial_id, trial_run_id, "group", state,
 	 end_time, metrics, total_batches)
 VALUES
-	(:trial_id, :trial_run_id, :state,
+	(:trial_id, :trial_run_id, :group, :state,
 	 :end_time, :metrics, :total_batches)
-ON CONFLICT (trial_id, trial_run_id, total_batches)
+ON CONFLICT (trial_id, trial_run_id, "group", total_batches)
 DO NOTHING
-`, model.TrialMetrics{
-		TrialID:    trialID,
-		TrialRunID: trialRunID,
-		State:      model.CompletedState,
-		EndTime:    ptrs.Ptr(time.Now().UTC()),
-		Metrics: map[string]interface{}{
-			"avg_metrics":   struct{}{},
-			"batch_metrics": []struct{}{},
+`, trialMetricsRow{
+		TrialMetrics: model.TrialMetrics{
+			TrialID:    trialID,
+			TrialRunID: trialRunID,
+			State:      model.CompletedState,
+			EndTime:    ptrs.Ptr(time.Now().UTC()),
+			Metrics: map[string]interface{}{
+				"avg_metrics":   struct{}{},
+				"batch_metrics": []struct{}{},
+			},
+			TotalBatches: stepsCompleted,
 		},
-		TotalBatches: stepsCompleted,
+		Group: trainingMetricGroup,
 	}); err != nil {
 		return errors.Wrap(err, "inserting training metrics")
 	}
@@ -415,8 +380,87 @@ WHERE id = $1
 }
 
 // setTrialBestValidation sets `public.trials.best_validation_id` to the `id` of the row in
-// `public.validations` corresponding to the trial's best validation.
-func setTrialBestValidation(tx *sqlx.Tx, id int) error {
+// `public.raw_trial_metrics` (filtered to the given, non-archived metricGroup) corresponding to
+// the trial's best validation, as measured by the named metric group's "<metricGroup>_metrics"
+// payload (e.g. "validation" for the built-in searcher metric). When the experiment's
+// config.searcher.metric_expression is set, the best validation is instead the one
+// minimizing/maximizing that compiled expression according to config.searcher.smaller_is_better
+// (default true); otherwise it falls back to the single named config.searcher.metric, signed the
+// same way. A metric_expression referencing a name outside what has actually been reported for
+// this trial/group is rejected as a validation error rather than silently never producing a best
+// validation.
+func setTrialBestValidation(tx *sqlx.Tx, id int, metricGroup string) error {
+	metricsKey := metricGroup + "_metrics"
+
+	var searcherExpr struct {
+		MetricExpression sql.NullString `db:"metric_expression"`
+		SmallerIsBetter  sql.NullBool   `db:"smaller_is_better"`
+	}
+	if err := tx.Get(&searcherExpr, `
+SELECT
+	config->'searcher'->>'metric_expression' AS metric_expression,
+	(config->'searcher'->>'smaller_is_better')::boolean AS smaller_is_better
+FROM experiments e
+INNER JOIN trials t ON t.experiment_id = e.id
+WHERE t.id = $1
+`, id); err != nil {
+		return errors.Wrapf(err, "fetching searcher metric expression for trial %d", id)
+	}
+
+	if searcherExpr.MetricExpression.Valid && searcherExpr.MetricExpression.String != "" {
+		// jsonb_object_keys only returns top-level keys; compileMetricExprNode/identifiers()
+		// support dotted paths into nested metrics (e.g. "optimizer.momentum"), so the recursive
+		// CTE below walks into every nested object and joins each level's key onto its parent's
+		// dotted path, collecting a name at every depth a metric_expression could reference.
+		var reportedMetricNames []string
+		if err := tx.Select(&reportedMetricNames, `
+WITH RECURSIVE metric_paths(path, value) AS (
+	SELECT kv.key, kv.value
+	FROM raw_trial_metrics v, jsonb_each(v.metrics->$1) AS kv(key, value)
+	WHERE v.trial_id = $2 AND v."group" = $3 AND NOT v.archived
+	UNION ALL
+	SELECT mp.path || '.' || kv.key, kv.value
+	FROM metric_paths mp, jsonb_each(mp.value) AS kv(key, value)
+	WHERE jsonb_typeof(mp.value) = 'object'
+)
+SELECT DISTINCT path AS name FROM metric_paths
+`, metricsKey, id, metricGroup); err != nil {
+			return errors.Wrapf(err, "fetching reported metric names for trial %d", id)
+		}
+		knownMetrics := make(map[string]bool, len(reportedMetricNames))
+		for _, name := range reportedMetricNames {
+			knownMetrics[name] = true
+		}
+
+		// Validating here, against the metrics actually reported so far, is our best substitute
+		// for experiment-create-time validation: this tree has no experiment-create code path to
+		// hook into, so an unknown identifier (typo'd or renamed metric) is instead caught and
+		// reported the first time it would otherwise silently fail to produce a best validation.
+		parsed, err := validateSearcherMetricExpr(searcherExpr.MetricExpression.String, knownMetrics)
+		if err != nil {
+			return api.AsValidationError("invalid searcher.metric_expression for trial %d: %s", id, err)
+		}
+		// Like the single-metric path below, the expression is signed so "best" is always the
+		// minimum of the signed value: smaller_is_better keeps its sign, larger_is_better flips it.
+		sign := -1
+		if !searcherExpr.SmallerIsBetter.Valid || searcherExpr.SmallerIsBetter.Bool {
+			sign = 1
+		}
+		_, err = tx.Exec(fmt.Sprintf(`
+WITH best_validation AS (
+	SELECT v.id AS id, %d * (%s) AS metric
+	FROM raw_trial_metrics v
+	WHERE v.trial_id = $1 AND v."group" = $2 AND NOT v.archived
+	ORDER BY metric ASC
+	LIMIT 1
+)
+UPDATE trials t
+SET best_validation_id = (SELECT bv.id FROM best_validation bv)
+WHERE t.id = $1;
+`, sign, parsed.compileSQL(metricsKey)), id, metricGroup)
+		return errors.Wrapf(err, "error updating best validation for trial %d", id)
+	}
+
 	_, err := tx.Exec(`
 WITH const AS (
     SELECT t.id as trial_id,
@@ -431,16 +475,16 @@ WITH const AS (
 ), best_validation AS (
 	SELECT
 		v.id AS id,
-		const.sign * (v.metrics->'validation_metrics'->>const.metric_name)::float8 AS metric
-	FROM validations v, const
-	WHERE v.trial_id = $1
+		const.sign * (v.metrics->$2->>const.metric_name)::float8 AS metric
+	FROM raw_trial_metrics v, const
+	WHERE v.trial_id = $1 AND v."group" = $3 AND NOT v.archived
 	ORDER BY metric ASC
 	LIMIT 1
 )
 UPDATE trials t
 SET best_validation_id = (SELECT bv.id FROM best_validation bv)
 WHERE t.id = $1;
-`, id)
+`, id, metricsKey, metricGroup)
 	return errors.Wrapf(err, "error updating best validation for trial %d", id)
 }
 
@@ -600,11 +644,15 @@ func (t *TrialsAugmented) Proto() *apiv1.AugmentedTrial {
 type TrialsAugmented struct {
 	bun.BaseModel `bun:"table:trials_augmented_view"`
 
-	TrialID               int32  `bun:"trial_id"`
-	State                 string `bun:"state"`
-	Hparams               string `bun:"hparams"`
-	TrainingMetrics       string `bun:"training_metrics"`
-	ValidationMetrics     string `bun:"validation_metrics"`
+	TrialID           int32  `bun:"trial_id"`
+	State             string `bun:"state"`
+	Hparams           string `bun:"hparams"`
+	TrainingMetrics   string `bun:"training_metrics"`
+	ValidationMetrics string `bun:"validation_metrics"`
+	// Metrics is a JSON object keyed by metric group (e.g. "training", "validation", or any
+	// other group a trial reported under), for filtering/ranking on metrics.<group>.<name>
+	// beyond the two built-in groups above.
+	Metrics               string `bun:"metrics"`
 	Tags                  string `bun:"tags"`
 	StartTime             string `bun:"start_time"`
 	EndTime               string `bun:"end_time"`
@@ -645,7 +693,32 @@ func (db *PgDB) RankUpdateQuery(q *bun.UpdateQuery, r *apiv1.QueryFilters_ExpRan
 	return q, nil
 }
 
-func (db *PgDB) FilterTrials(q bun.QueryBuilder, filters *apiv1.QueryFilters) bun.QueryBuilder {
+// jsonPathExpr translates a dotted field name like "optimizer.momentum" into a chained jsonb
+// traversal such as `hparams->'optimizer'->>'momentum'`, so nested hparams and metrics can be
+// filtered without a separate API shape per nesting depth. Every path segment is validated to be
+// a plain identifier so it's safe to inline into the query string.
+func jsonPathExpr(column, name string) (string, error) {
+	segments := strings.Split(name, ".")
+	for _, s := range segments {
+		if s == "" || !pathSegmentRegexp.MatchString(s) {
+			return "", api.AsValidationError("invalid filter name %q", name)
+		}
+	}
+
+	expr := column
+	for i, s := range segments {
+		op := "->"
+		if i == len(segments)-1 {
+			op = "->>"
+		}
+		expr += fmt.Sprintf("%s'%s'", op, s)
+	}
+	return expr, nil
+}
+
+var pathSegmentRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+func (db *PgDB) FilterTrials(q bun.QueryBuilder, filters *apiv1.QueryFilters) (bun.QueryBuilder, error) {
 	if len(filters.Tags) > 0 {
 		tagExprKeyVals := ""
 		for _, tag := range filters.Tags {
@@ -666,23 +739,78 @@ func (db *PgDB) FilterTrials(q bun.QueryBuilder, filters *apiv1.QueryFilters) bu
 
 	if len(filters.ValidationMetrics) > 0 {
 		for _, f := range filters.ValidationMetrics {
-			q = q.Where("(validation_metrics->>?)::float8 BETWEEN ? AND ?", f.Name, f.Min, f.Max)
+			expr, err := jsonPathExpr("validation_metrics", f.Name)
+			if err != nil {
+				return nil, err
+			}
+			q = q.Where(fmt.Sprintf("(%s)::float8 BETWEEN ? AND ?", expr), f.Min, f.Max)
 		}
 	}
 
 	if len(filters.TrainingMetrics) > 0 {
 		for _, f := range filters.TrainingMetrics {
-			q = q.Where("(training_metrics->>?)::float8 BETWEEN ? AND ?", f.Name, f.Min, f.Max)
+			expr, err := jsonPathExpr("training_metrics", f.Name)
+			if err != nil {
+				return nil, err
+			}
+			q = q.Where(fmt.Sprintf("(%s)::float8 BETWEEN ? AND ?", expr), f.Min, f.Max)
 		}
 	}
+	// NOTE: f.Value and the apiv1.QueryFilters_HparamFilter_Range/StringEq/StringIn/BoolEq/
+	// CategoricalIn oneof cases below presuppose a proto message shape that hasn't actually been
+	// added anywhere: this tree has no .proto source for apiv1.QueryFilters at all (it, like
+	// trialv1, is an external/generated package outside this snapshot), and the baseline
+	// HparamFilter this replaced was a flat {Name, Min, Max} struct with no Value oneof. Against an
+	// apiv1 package without that oneof this file does not compile, so no branch of the type switch
+	// below is reachable.
 	if len(filters.Hparams) > 0 {
-		// what if it's a string?
-		// given the protos, we would probably need a different type
-		// what about nested?
-		// in that case, we probably want to send outer.inner in the api
-		// then construct trials.hparams->'outer'->'inner' expression in query
 		for _, f := range filters.Hparams {
-			q = q.Where("(hparams->>?)::float8 BETWEEN ? AND ?", f.Name, f.Min, f.Max)
+			expr, err := jsonPathExpr("hparams", f.Name)
+			if err != nil {
+				return nil, err
+			}
+
+			switch v := f.Value.(type) {
+			case *apiv1.QueryFilters_HparamFilter_Range:
+				q = q.Where(fmt.Sprintf("(%s)::float8 BETWEEN ? AND ?", expr), v.Range.Min, v.Range.Max)
+			case *apiv1.QueryFilters_HparamFilter_StringEq:
+				q = q.Where(fmt.Sprintf("(%s)::text = ?", expr), v.StringEq)
+			case *apiv1.QueryFilters_HparamFilter_StringIn:
+				q = q.Where(fmt.Sprintf("(%s)::text IN (?)", expr), bun.In(v.StringIn.Values))
+			case *apiv1.QueryFilters_HparamFilter_BoolEq:
+				q = q.Where(fmt.Sprintf("(%s)::bool = ?", expr), v.BoolEq)
+			case *apiv1.QueryFilters_HparamFilter_CategoricalIn:
+				q = q.Where(fmt.Sprintf("(%s)::text IN (?)", expr), bun.In(v.CategoricalIn.Values))
+			default:
+				return nil, api.AsValidationError("hparam filter %q: no value set", f.Name)
+			}
+		}
+	}
+	if len(filters.Metrics) > 0 {
+		// filters.Metrics filters/ranks on metrics.<group>.<name>, covering groups beyond the
+		// built-in "training"/"validation" ones ValidationMetrics/TrainingMetrics above cover.
+		// Same proto caveat as the Hparams case above applies to filters.Metrics and its
+		// HparamFilter-shaped Value field: no .proto source defines either in this tree.
+		for _, f := range filters.Metrics {
+			expr, err := jsonPathExpr("metrics", f.Name)
+			if err != nil {
+				return nil, err
+			}
+
+			switch v := f.Value.(type) {
+			case *apiv1.QueryFilters_HparamFilter_Range:
+				q = q.Where(fmt.Sprintf("(%s)::float8 BETWEEN ? AND ?", expr), v.Range.Min, v.Range.Max)
+			case *apiv1.QueryFilters_HparamFilter_StringEq:
+				q = q.Where(fmt.Sprintf("(%s)::text = ?", expr), v.StringEq)
+			case *apiv1.QueryFilters_HparamFilter_StringIn:
+				q = q.Where(fmt.Sprintf("(%s)::text IN (?)", expr), bun.In(v.StringIn.Values))
+			case *apiv1.QueryFilters_HparamFilter_BoolEq:
+				q = q.Where(fmt.Sprintf("(%s)::bool = ?", expr), v.BoolEq)
+			case *apiv1.QueryFilters_HparamFilter_CategoricalIn:
+				q = q.Where(fmt.Sprintf("(%s)::text IN (?)", expr), bun.In(v.CategoricalIn.Values))
+			default:
+				return nil, api.AsValidationError("metric filter %q: no value set", f.Name)
+			}
 		}
 	}
 	if filters.Searcher != "" {
@@ -692,5 +820,5 @@ func (db *PgDB) FilterTrials(q bun.QueryBuilder, filters *apiv1.QueryFilters) bu
 		q = q.Where("user_id IN (?)", bun.In(filters.UserIds))
 	}
 
-	return q
+	return q, nil
 }
@@ -0,0 +1,151 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/uptrace/bun"
+
+	"github.com/determined-ai/determined/master/internal/api"
+	"github.com/determined-ai/determined/proto/pkg/apiv1"
+)
+
+// AggregateTrials answers grouped aggregate queries over TrialsAugmented (e.g. "p50/p95 of
+// validation loss grouped by hparams.optimizer.name", "trial count by workspace_id") in a single
+// query, so searcher-analysis dashboards don't need raw per-trial metric rows shipped to the
+// client just to compute a summary. Group-by and aggregation fields are view columns or dotted
+// jsonb paths only; derived values such as a trial's duration (end_time minus start_time) are
+// not available as fields.
+//
+// NOTE: apiv1.AggregateTrialsRequest/AggregateTrialsResponse/AggregateTrialsRequest_Aggregation
+// are referenced here as though they're already generated proto bindings, but this tree has no
+// .proto source defining them anywhere (nor the rest of the apiv1 package, which like trialv1 is
+// generated/vendored outside this snapshot) — there's no way to add or regenerate a real binding
+// for this family from here. This file is written to the shape the real message family would need
+// to have; it can't be built or exercised until that proto addition actually lands upstream.
+func (db *PgDB) AggregateTrials(
+	ctx context.Context, req *apiv1.AggregateTrialsRequest,
+) (*apiv1.AggregateTrialsResponse, error) {
+	if len(req.Aggregations) == 0 {
+		return nil, api.AsValidationError("aggregate_trials requires at least one aggregation")
+	}
+
+	filters := req.Filters
+	if filters == nil {
+		// FilterTrials does raw field access on filters; treat an omitted filter set as
+		// "no filters" rather than panicking on a nil pointer.
+		filters = &apiv1.QueryFilters{}
+	}
+
+	q := db.bun.NewSelect().Model((*TrialsAugmented)(nil))
+	qb, err := db.FilterTrials(q, filters)
+	if err != nil {
+		return nil, err
+	}
+	q = qb.(*bun.SelectQuery)
+
+	for i, field := range req.GroupBy {
+		expr, err := aggregateFieldExpr(field)
+		if err != nil {
+			return nil, err
+		}
+		alias := fmt.Sprintf("group_%d", i)
+		q = q.ColumnExpr(fmt.Sprintf("(%s)::text AS %s", expr, alias)).GroupExpr(expr)
+	}
+
+	aggAliases := make([]string, len(req.Aggregations))
+	for i, agg := range req.Aggregations {
+		expr, err := aggregateSelectExpr(agg)
+		if err != nil {
+			return nil, err
+		}
+		aggAliases[i] = fmt.Sprintf("agg_%d", i)
+		q = q.ColumnExpr(fmt.Sprintf("%s AS %s", expr, aggAliases[i]))
+	}
+
+	rows, err := q.Rows(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "aggregating trials")
+	}
+	defer rows.Close()
+
+	resp := &apiv1.AggregateTrialsResponse{}
+	for rows.Next() {
+		groupValues := make([]sql.NullString, len(req.GroupBy))
+		aggValues := make([]sql.NullFloat64, len(req.Aggregations))
+
+		dest := make([]interface{}, 0, len(groupValues)+len(aggValues))
+		for i := range groupValues {
+			dest = append(dest, &groupValues[i])
+		}
+		for i := range aggValues {
+			dest = append(dest, &aggValues[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, errors.Wrap(err, "scanning aggregate trials row")
+		}
+
+		row := &apiv1.AggregateTrialsResponse_Row{
+			GroupValues: make([]string, len(groupValues)),
+			Values:      make([]float64, len(aggValues)),
+		}
+		for i, v := range groupValues {
+			row.GroupValues[i] = v.String
+		}
+		for i, v := range aggValues {
+			row.Values[i] = v.Float64
+		}
+		resp.Results = append(resp.Results, row)
+	}
+	return resp, errors.Wrap(rows.Err(), "iterating aggregate trials rows")
+}
+
+// aggregateFieldExpr translates a group_by/aggregation field name into the jsonb-chained SQL
+// expression it reads from, supporting the same dotted-path hparam/metric addressing FilterTrials
+// uses (e.g. "hparams.optimizer.name", "validation_metrics.loss") in addition to plain top-level
+// columns (e.g. "workspace_id").
+func aggregateFieldExpr(field string) (string, error) {
+	for _, prefix := range []string{"hparams.", "training_metrics.", "validation_metrics.", "metrics."} {
+		if strings.HasPrefix(field, prefix) {
+			return jsonPathExpr(strings.TrimSuffix(prefix, "."), strings.TrimPrefix(field, prefix))
+		}
+	}
+	if field == "" || !pathSegmentRegexp.MatchString(field) {
+		return "", api.AsValidationError("invalid field %q", field)
+	}
+	return field, nil
+}
+
+// aggregateSelectExpr compiles a single requested aggregation into a SQL select expression.
+func aggregateSelectExpr(agg *apiv1.AggregateTrialsRequest_Aggregation) (string, error) {
+	if agg.Func == apiv1.AggregateTrialsRequest_AGGREGATION_FUNC_COUNT {
+		return "count(*)", nil
+	}
+
+	expr, err := aggregateFieldExpr(agg.Field)
+	if err != nil {
+		return "", err
+	}
+	numeric := fmt.Sprintf("(%s)::float8", expr)
+
+	switch agg.Func {
+	case apiv1.AggregateTrialsRequest_AGGREGATION_FUNC_AVG:
+		return fmt.Sprintf("avg(%s)", numeric), nil
+	case apiv1.AggregateTrialsRequest_AGGREGATION_FUNC_MIN:
+		return fmt.Sprintf("min(%s)", numeric), nil
+	case apiv1.AggregateTrialsRequest_AGGREGATION_FUNC_MAX:
+		return fmt.Sprintf("max(%s)", numeric), nil
+	case apiv1.AggregateTrialsRequest_AGGREGATION_FUNC_STDDEV:
+		return fmt.Sprintf("stddev(%s)", numeric), nil
+	case apiv1.AggregateTrialsRequest_AGGREGATION_FUNC_PERCENTILE_CONT:
+		if agg.Percentile < 0 || agg.Percentile > 1 {
+			return "", api.AsValidationError("percentile must be between 0 and 1, got %v", agg.Percentile)
+		}
+		return fmt.Sprintf("percentile_cont(%v) WITHIN GROUP (ORDER BY %s)", agg.Percentile, numeric), nil
+	default:
+		return "", api.AsValidationError("unsupported aggregation function %v", agg.Func)
+	}
+}
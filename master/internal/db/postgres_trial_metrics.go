@@ -0,0 +1,348 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgtype"
+	"github.com/jackc/pgx/v4/stdlib"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+
+	"github.com/determined-ai/determined/master/internal/api"
+	"github.com/determined-ai/determined/master/pkg/model"
+	"github.com/determined-ai/determined/proto/pkg/trialv1"
+)
+
+// Well-known metric groups. Callers may also report under any other group name (e.g.
+// "profiling", "rl_rollout") to land metrics in raw_trial_metrics without a hardcoded table.
+const (
+	trainingMetricGroup   = "training"
+	validationMetricGroup = "validation"
+)
+
+// trialRun identifies the (trial, run) a batch of metric reports belongs to. Run-id validation
+// and rollback archival both operate per-run, not per-report.
+type trialRun struct {
+	trialID    int32
+	trialRunID int32
+}
+
+// trialMetricsRow is the raw_trial_metrics counterpart of model.TrialMetrics, adding the group
+// column that disambiguates which kind of metrics a row holds.
+type trialMetricsRow struct {
+	model.TrialMetrics
+	Group string `db:"group"`
+}
+
+func groupMetricsByRun(metrics []*trialv1.TrialMetrics) map[trialRun][]*trialv1.TrialMetrics {
+	groups := map[trialRun][]*trialv1.TrialMetrics{}
+	for _, m := range metrics {
+		key := trialRun{trialID: m.TrialId, trialRunID: m.TrialRunId}
+		groups[key] = append(groups[key], m)
+	}
+	return groups
+}
+
+func minStepsCompleted(metrics []*trialv1.TrialMetrics) int32 {
+	min := metrics[0].StepsCompleted
+	for _, m := range metrics[1:] {
+		if m.StepsCompleted < min {
+			min = m.StepsCompleted
+		}
+	}
+	return min
+}
+
+// archiveTrialMetrics marks rows in group for (trialID, trialRunID) preceding trialRunID as
+// archived once total_batches reaches stepsCompleted, on the assumption that an earlier run
+// rolled back and is about to be superseded by reports from the current run.
+func archiveTrialMetrics(
+	ctx context.Context, tx *sqlx.Tx, group string, trialID, trialRunID, stepsCompleted int32,
+) error {
+	return archiveTrialMetricsCompare(ctx, tx, group, trialID, trialRunID, stepsCompleted, ">=")
+}
+
+// archiveTrialMetricsCompare is archiveTrialMetrics with an explicit comparison against
+// total_batches, for the rare caller (training metrics archiving stale validations) that needs
+// ">" rather than the ">=" every group uses for its own rows.
+func archiveTrialMetricsCompare(
+	ctx context.Context, tx *sqlx.Tx, group string, trialID, trialRunID, stepsCompleted int32, compare string,
+) error {
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`
+UPDATE raw_trial_metrics SET archived = true
+WHERE trial_id = $1
+  AND trial_run_id < $2
+  AND "group" = $3
+  AND total_batches %s $4;
+`, compare), trialID, trialRunID, group, stepsCompleted); err != nil {
+		return errors.Wrapf(err, "archiving %s metrics", group)
+	}
+	return nil
+}
+
+// insertTrialMetrics inserts a single completed metrics row into raw_trial_metrics for group.
+func insertTrialMetrics(
+	ctx context.Context, tx *sqlx.Tx, group string, trialID, trialRunID, stepsCompleted int32,
+	metrics map[string]interface{},
+) error {
+	if _, err := tx.NamedExecContext(ctx, `
+INSERT INTO raw_trial_metrics
+	(trial_id, trial_run_id, "group", state, end_time, metrics, total_batches)
+VALUES
+	(:trial_id, :trial_run_id, :group, :state, now(), :metrics, :total_batches)
+`, trialMetricsRow{
+		TrialMetrics: model.TrialMetrics{
+			TrialID:      int(trialID),
+			TrialRunID:   int(trialRunID),
+			State:        model.CompletedState,
+			Metrics:      metrics,
+			TotalBatches: int(stepsCompleted),
+		},
+		Group: group,
+	}); err != nil {
+		return errors.Wrapf(err, "inserting %s metrics", group)
+	}
+	return nil
+}
+
+// AddTrialMetrics adds a completed report of metrics for an arbitrary named group (profiling,
+// gradient/weight stats, generation samples, RL rollout stats, ...) to raw_trial_metrics, under
+// the conventional "<group>_metrics" key. AddTrainingMetrics and AddValidationMetrics are thin
+// wrappers over this same archive-then-insert path for their own, differently-shaped payloads.
+func (db *PgDB) AddTrialMetrics(ctx context.Context, group string, m *trialv1.TrialMetrics) error {
+	return db.withTransaction(fmt.Sprintf("add %s metrics", group), func(tx *sqlx.Tx) error {
+		if err := checkTrialRunID(ctx, tx, m.TrialId, m.TrialRunId); err != nil {
+			return err
+		}
+		if err := archiveTrialMetrics(ctx, tx, group, m.TrialId, m.TrialRunId, m.StepsCompleted); err != nil {
+			return err
+		}
+		return insertTrialMetrics(ctx, tx, group, m.TrialId, m.TrialRunId, m.StepsCompleted,
+			map[string]interface{}{group + "_metrics": m.Metrics})
+	})
+}
+
+// AddTrialMetricsBatch is the bulk counterpart of AddTrialMetrics: reports are grouped by
+// (trial_id, trial_run_id), run_id is validated and the archival UPDATE runs once per group
+// against its minimum steps_completed, and rows are streamed into raw_trial_metrics via
+// Postgres' COPY protocol where the driver supports it, falling back to a single multi-row
+// INSERT otherwise.
+func (db *PgDB) AddTrialMetricsBatch(ctx context.Context, group string, metrics []*trialv1.TrialMetrics) error {
+	return db.addTrialMetricsBatch(ctx, group, metrics, func(m *trialv1.TrialMetrics) map[string]interface{} {
+		return map[string]interface{}{group + "_metrics": m.Metrics}
+	})
+}
+
+// AddTrainingMetricsBatch is the bulk counterpart of AddTrainingMetrics. Like AddTrainingMetrics,
+// it also archives stale validationMetricGroup rows as a rollback safety net, since a reported
+// rollback is only ever observed through a subsequent training report.
+func (db *PgDB) AddTrainingMetricsBatch(ctx context.Context, metrics []*trialv1.TrialMetrics) error {
+	return db.addTrialMetricsBatch(ctx, trainingMetricGroup, metrics, func(m *trialv1.TrialMetrics) map[string]interface{} {
+		return map[string]interface{}{
+			"avg_metrics":   m.Metrics,
+			"batch_metrics": m.BatchMetrics,
+		}
+	}, validationMetricGroup)
+}
+
+// AddValidationMetricsBatch is the bulk counterpart of AddValidationMetrics. It additionally
+// recomputes best_validation_id for every trial touched by the batch, once per trial rather than
+// once per report.
+func (db *PgDB) AddValidationMetricsBatch(ctx context.Context, metrics []*trialv1.TrialMetrics) error {
+	if err := db.addTrialMetricsBatch(ctx, validationMetricGroup, metrics, func(m *trialv1.TrialMetrics) map[string]interface{} {
+		return map[string]interface{}{"validation_metrics": m.Metrics}
+	}); err != nil {
+		return err
+	}
+
+	trialIDs := map[int32]bool{}
+	for _, m := range metrics {
+		trialIDs[m.TrialId] = true
+	}
+
+	return db.withTransaction("update trial best validation (batch)", func(tx *sqlx.Tx) error {
+		for trialID := range trialIDs {
+			if err := setTrialBestValidation(tx, int(trialID), validationMetricGroup); err != nil {
+				return errors.Wrap(err, "updating trial best validation")
+			}
+		}
+		return nil
+	})
+}
+
+// addTrialMetricsBatch runs the batch's archival UPDATEs and its row insert in a single
+// transaction, mirroring the atomicity AddTrialMetrics gets from its own single db.withTransaction
+// call: a failed insert can no longer leave rows stranded mid-archive. alsoArchiveOnRollback names
+// any additional groups that should be archived (with the ">" comparator, as a rollback safety
+// net) alongside group's own rows for each run touched by the batch — AddTrainingMetricsBatch uses
+// this to also archive stale validationMetricGroup rows, matching what AddTrainingMetrics does for
+// a single report.
+//
+// The transaction prefers a raw pgx connection so the insert can use Postgres' COPY protocol; where
+// one can't be acquired (e.g. a test DSN backed by a different driver), it falls back to a plain
+// sqlx transaction with a multi-row INSERT, which is still atomic, just without the COPY
+// performance optimization.
+func (db *PgDB) addTrialMetricsBatch(
+	ctx context.Context, group string, metrics []*trialv1.TrialMetrics,
+	toMetrics func(*trialv1.TrialMetrics) map[string]interface{},
+	alsoArchiveOnRollback ...string,
+) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	groups := groupMetricsByRun(metrics)
+	rows := make([]trialMetricsRow, 0, len(metrics))
+	for _, m := range metrics {
+		rows = append(rows, trialMetricsRow{
+			TrialMetrics: model.TrialMetrics{
+				TrialID:      int(m.TrialId),
+				TrialRunID:   int(m.TrialRunId),
+				State:        model.CompletedState,
+				Metrics:      toMetrics(m),
+				TotalBatches: int(m.StepsCompleted),
+			},
+			Group: group,
+		})
+	}
+
+	conn, err := stdlib.AcquireConn(db.sql.DB)
+	if err != nil {
+		return db.withTransaction(fmt.Sprintf("add %s metrics batch", group), func(tx *sqlx.Tx) error {
+			for key, runMetrics := range groups {
+				if err := checkTrialRunID(ctx, tx, key.trialID, key.trialRunID); err != nil {
+					return err
+				}
+				steps := minStepsCompleted(runMetrics)
+				if err := archiveTrialMetrics(ctx, tx, group, key.trialID, key.trialRunID, steps); err != nil {
+					return err
+				}
+				for _, rollbackGroup := range alsoArchiveOnRollback {
+					if err := archiveTrialMetricsCompare(
+						ctx, tx, rollbackGroup, key.trialID, key.trialRunID, steps, ">",
+					); err != nil {
+						return err
+					}
+				}
+			}
+			return multiRowInsertTrialMetrics(ctx, tx, rows)
+		})
+	}
+	defer func() {
+		_ = stdlib.ReleaseConn(db.sql.DB, conn)
+	}()
+
+	pgTx, err := conn.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "beginning batch metrics transaction")
+	}
+	defer func() {
+		_ = pgTx.Rollback(ctx)
+	}()
+
+	for key, runMetrics := range groups {
+		if err := checkTrialRunIDPgx(ctx, pgTx, key.trialID, key.trialRunID); err != nil {
+			return err
+		}
+		steps := minStepsCompleted(runMetrics)
+		if err := archiveTrialMetricsPgx(ctx, pgTx, group, key.trialID, key.trialRunID, steps, ">="); err != nil {
+			return err
+		}
+		for _, rollbackGroup := range alsoArchiveOnRollback {
+			if err := archiveTrialMetricsPgx(
+				ctx, pgTx, rollbackGroup, key.trialID, key.trialRunID, steps, ">",
+			); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := copyInsertTrialMetrics(ctx, pgTx, rows); err != nil {
+		return err
+	}
+
+	return errors.Wrap(pgTx.Commit(ctx), "committing batch metrics transaction")
+}
+
+// checkTrialRunIDPgx is checkTrialRunID against a raw pgx.Tx, for the batch insert path that
+// manages its own pgx-native transaction instead of an *sqlx.Tx.
+func checkTrialRunIDPgx(ctx context.Context, tx pgx.Tx, trialID, runID int32) error {
+	var cRunID int32
+	switch err := tx.QueryRow(ctx, `SELECT run_id FROM trials WHERE id = $1`, trialID).Scan(&cRunID); {
+	case err != nil:
+		return errors.Wrap(err, "querying current run")
+	case runID != cRunID:
+		return api.AsValidationError("invalid run id, %d (reported) != %d (expected)", runID, cRunID)
+	default:
+		return nil
+	}
+}
+
+// archiveTrialMetricsPgx is archiveTrialMetricsCompare against a raw pgx.Tx.
+func archiveTrialMetricsPgx(
+	ctx context.Context, tx pgx.Tx, group string, trialID, trialRunID, stepsCompleted int32, compare string,
+) error {
+	if _, err := tx.Exec(ctx, fmt.Sprintf(`
+UPDATE raw_trial_metrics SET archived = true
+WHERE trial_id = $1
+  AND trial_run_id < $2
+  AND "group" = $3
+  AND total_batches %s $4;
+`, compare), trialID, trialRunID, group, stepsCompleted); err != nil {
+		return errors.Wrapf(err, "archiving %s metrics", group)
+	}
+	return nil
+}
+
+// copyInsertTrialMetrics streams rows into raw_trial_metrics via Postgres' COPY protocol.
+func copyInsertTrialMetrics(ctx context.Context, tx pgx.Tx, rows []trialMetricsRow) error {
+	copyRows := make([][]interface{}, 0, len(rows))
+	for _, r := range rows {
+		metricsJSON, err := json.Marshal(r.Metrics)
+		if err != nil {
+			return errors.Wrap(err, "marshaling metrics for copy")
+		}
+		copyRows = append(copyRows, []interface{}{
+			r.TrialID, r.TrialRunID, r.Group, r.State, time.Now().UTC(),
+			pgtype.JSONB{Bytes: metricsJSON, Status: pgtype.Present}, r.TotalBatches,
+		})
+	}
+
+	_, err := tx.CopyFrom(ctx,
+		pgx.Identifier{"raw_trial_metrics"},
+		[]string{"trial_id", "trial_run_id", "group", "state", "end_time", "metrics", "total_batches"},
+		pgx.CopyFromRows(copyRows))
+	return errors.Wrap(err, "copying rows into raw_trial_metrics")
+}
+
+// multiRowInsertTrialMetrics is the sqlx-transaction fallback for copyInsertTrialMetrics, used
+// when a raw pgx connection can't be acquired for the batch.
+func multiRowInsertTrialMetrics(ctx context.Context, tx *sqlx.Tx, rows []trialMetricsRow) error {
+	valuesSQL := make([]string, 0, len(rows))
+	args := make([]interface{}, 0, len(rows)*6)
+	for i, r := range rows {
+		metricsJSON, err := json.Marshal(r.Metrics)
+		if err != nil {
+			return errors.Wrap(err, "marshaling metrics")
+		}
+
+		base := i * 6
+		valuesSQL = append(valuesSQL, fmt.Sprintf(
+			"($%d, $%d, $%d, $%d, now(), $%d, $%d)",
+			base+1, base+2, base+3, base+4, base+5, base+6))
+		args = append(args, r.TrialID, r.TrialRunID, r.Group, r.State, metricsJSON, r.TotalBatches)
+	}
+
+	query := fmt.Sprintf(`
+INSERT INTO raw_trial_metrics (trial_id, trial_run_id, "group", state, end_time, metrics, total_batches)
+VALUES %s
+`, strings.Join(valuesSQL, ", "))
+
+	_, err := tx.ExecContext(ctx, query, args...)
+	return errors.Wrap(err, "bulk inserting rows into raw_trial_metrics")
+}
@@ -0,0 +1,434 @@
+package db
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// searcherMetricExpr is the parsed form of a config.searcher.metric_expression string: a small,
+// safe expression grammar over validation metric names supporting +, -, *, /, min, max, abs,
+// numeric literals (including inf/-inf), and ternary (cond ? a : b, where cond is a comparison
+// and a and b may themselves be ternaries). It exists so "best validation" can be driven by a composite of metrics
+// (e.g. "0.7*accuracy - 0.3*latency" or "f1 > 0 ? f1 : -inf") instead of only a single named
+// metric, without letting arbitrary SQL reach the database.
+//
+// Grammar (expr):
+//
+//	expr       := ternary
+//	ternary    := comparison ( '?' expr ':' expr )?
+//	comparison := additive ( ('>'|'<'|'>='|'<='|'=='|'!=') additive )?
+//	additive   := multiplicative ( ('+'|'-') multiplicative )*
+//	multiplicative := unary ( ('*'|'/') unary )*
+//	unary      := '-' unary | primary
+//	primary    := number | 'inf' | identifier
+//	           | ('min'|'max') '(' expr ',' expr ')' | 'abs' '(' expr ')' | '(' expr ')'
+type searcherMetricExpr struct {
+	root metricExprNode
+}
+
+// metricExprNode is one node of a parsed searcher metric expression.
+type metricExprNode struct {
+	kind metricExprKind
+	// num is set for kindNumber.
+	num float64
+	// name is set for kindIdent.
+	name string
+	// op is set for kindBinary and kindCompare (+ - * / > < >= <= == !=).
+	op string
+	// args holds operands: 1 for kindUnaryMinus/kindAbs, 2 for kindBinary/kindCompare/kindMinMax,
+	// 3 for kindTernary (cond, then, else).
+	args []metricExprNode
+}
+
+type metricExprKind int
+
+const (
+	kindNumber metricExprKind = iota
+	kindIdent
+	kindBinary
+	kindUnaryMinus
+	kindCompare
+	kindTernary
+	kindAbs
+	kindMinMax
+)
+
+// parseSearcherMetricExpr parses a metric_expression string into a searcherMetricExpr, rejecting
+// anything outside the grammar above so the result can be compiled straight into SQL.
+func parseSearcherMetricExpr(expr string) (*searcherMetricExpr, error) {
+	p := &metricExprParser{tokens: tokenizeMetricExpr(expr), src: expr}
+	node, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.atEnd() {
+		return nil, errors.Errorf("unexpected trailing input in metric expression %q", expr)
+	}
+	return &searcherMetricExpr{root: node}, nil
+}
+
+// identifiers returns the distinct metric names referenced by expr, for validating them against
+// the set of metrics reported so far for a trial's metric group.
+func (e *searcherMetricExpr) identifiers() []string {
+	seen := map[string]bool{}
+	var names []string
+	var walk func(n metricExprNode)
+	walk = func(n metricExprNode) {
+		if n.kind == kindIdent && !seen[n.name] {
+			seen[n.name] = true
+			names = append(names, n.name)
+		}
+		for _, a := range n.args {
+			walk(a)
+		}
+	}
+	walk(e.root)
+	return names
+}
+
+// validateSearcherMetricExpr parses expr and confirms every identifier it references is in
+// knownMetrics, so a typo or renamed metric is caught and reported rather than silently producing
+// NULLs (and therefore no best validation) on every validation report. It returns the parsed
+// expression so callers that already have knownMetrics handy don't have to parse expr twice.
+func validateSearcherMetricExpr(expr string, knownMetrics map[string]bool) (*searcherMetricExpr, error) {
+	parsed, err := parseSearcherMetricExpr(expr)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range parsed.identifiers() {
+		if !knownMetrics[name] {
+			return nil, errors.Errorf("searcher.metric_expression references unknown metric %q", name)
+		}
+	}
+	return parsed, nil
+}
+
+// compileSQL renders expr as a SQL float8 expression, extracting each identifier from
+// `v.metrics->metricsKey->>name` (metricsKey is a trusted internal constant, never user input;
+// identifiers were validated to be simple names during parsing).
+func (e *searcherMetricExpr) compileSQL(metricsKey string) string {
+	return compileMetricExprNode(e.root, metricsKey)
+}
+
+func compileMetricExprNode(n metricExprNode, metricsKey string) string {
+	switch n.kind {
+	case kindNumber:
+		if math.IsInf(n.num, 1) {
+			return "'Infinity'::float8"
+		}
+		if math.IsInf(n.num, -1) {
+			return "'-Infinity'::float8"
+		}
+		return strconv.FormatFloat(n.num, 'g', -1, 64)
+	case kindIdent:
+		// name may itself be a dotted path (e.g. "optimizer.momentum") into a nested metric.
+		expr := fmt.Sprintf("v.metrics->'%s'", metricsKey)
+		segments := strings.Split(n.name, ".")
+		for i, s := range segments {
+			op := "->"
+			if i == len(segments)-1 {
+				op = "->>"
+			}
+			expr += fmt.Sprintf("%s'%s'", op, s)
+		}
+		return fmt.Sprintf("(%s)::float8", expr)
+	case kindUnaryMinus:
+		return fmt.Sprintf("(-%s)", compileMetricExprNode(n.args[0], metricsKey))
+	case kindAbs:
+		return fmt.Sprintf("abs(%s)", compileMetricExprNode(n.args[0], metricsKey))
+	case kindMinMax:
+		fn := "least"
+		if n.op == "max" {
+			fn = "greatest"
+		}
+		return fmt.Sprintf("%s(%s, %s)", fn,
+			compileMetricExprNode(n.args[0], metricsKey), compileMetricExprNode(n.args[1], metricsKey))
+	case kindBinary:
+		return fmt.Sprintf("(%s %s %s)",
+			compileMetricExprNode(n.args[0], metricsKey), n.op, compileMetricExprNode(n.args[1], metricsKey))
+	case kindCompare:
+		return fmt.Sprintf("(%s %s %s)",
+			compileMetricExprNode(n.args[0], metricsKey), n.op, compileMetricExprNode(n.args[1], metricsKey))
+	case kindTernary:
+		return fmt.Sprintf("(CASE WHEN %s THEN %s ELSE %s END)",
+			compileMetricExprNode(n.args[0], metricsKey),
+			compileMetricExprNode(n.args[1], metricsKey),
+			compileMetricExprNode(n.args[2], metricsKey))
+	default:
+		panic(fmt.Sprintf("unhandled metric expression node kind %d", n.kind))
+	}
+}
+
+// metricExprToken and metricExprParser implement a small hand-rolled recursive-descent parser;
+// the grammar is tiny enough that pulling in a parser generator or expression library would be
+// more ceremony than it saves.
+type metricExprToken struct {
+	text  string
+	num   float64
+	isNum bool
+}
+
+func tokenizeMetricExpr(expr string) []metricExprToken {
+	var tokens []metricExprToken
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case strings.ContainsRune("+-*/()?:,", c):
+			tokens = append(tokens, metricExprToken{text: string(c)})
+			i++
+		case c == '>' || c == '<' || c == '=' || c == '!':
+			// Bare '=' or '!' without a following '=' isn't part of the grammar; tokenized as its
+			// own single-char token so the parser reports it as unexpected input.
+			if i+1 < len(runes) && runes[i+1] == '=' {
+				tokens = append(tokens, metricExprToken{text: string(c) + "="})
+				i += 2
+			} else {
+				tokens = append(tokens, metricExprToken{text: string(c)})
+				i++
+			}
+		case (c >= '0' && c <= '9') || c == '.':
+			j := i
+			for j < len(runes) && ((runes[j] >= '0' && runes[j] <= '9') || runes[j] == '.') {
+				j++
+			}
+			numStr := string(runes[i:j])
+			f, err := strconv.ParseFloat(numStr, 64)
+			if err == nil {
+				tokens = append(tokens, metricExprToken{num: f, isNum: true})
+			} else {
+				tokens = append(tokens, metricExprToken{text: numStr})
+			}
+			i = j
+		case isIdentStart(c):
+			j := i
+			for j < len(runes) && isIdentPart(runes[j]) {
+				j++
+			}
+			tokens = append(tokens, metricExprToken{text: string(runes[i:j])})
+			i = j
+		default:
+			tokens = append(tokens, metricExprToken{text: string(c)})
+			i++
+		}
+	}
+	return tokens
+}
+
+func isIdentStart(c rune) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentPart(c rune) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9') || c == '.'
+}
+
+type metricExprParser struct {
+	tokens []metricExprToken
+	pos    int
+	src    string
+}
+
+func (p *metricExprParser) atEnd() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *metricExprParser) peek() (metricExprToken, bool) {
+	if p.atEnd() {
+		return metricExprToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *metricExprParser) consume(text string) bool {
+	if t, ok := p.peek(); ok && !t.isNum && t.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *metricExprParser) parseExpr() (metricExprNode, error) {
+	return p.parseTernary()
+}
+
+func (p *metricExprParser) parseTernary() (metricExprNode, error) {
+	cond, err := p.parseComparison()
+	if err != nil {
+		return metricExprNode{}, err
+	}
+	if !p.consume("?") {
+		return cond, nil
+	}
+	then, err := p.parseExpr()
+	if err != nil {
+		return metricExprNode{}, err
+	}
+	if !p.consume(":") {
+		return metricExprNode{}, errors.Errorf("expected ':' in ternary expression %q", p.src)
+	}
+	els, err := p.parseExpr()
+	if err != nil {
+		return metricExprNode{}, err
+	}
+	return metricExprNode{kind: kindTernary, args: []metricExprNode{cond, then, els}}, nil
+}
+
+func (p *metricExprParser) parseComparison() (metricExprNode, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return metricExprNode{}, err
+	}
+	for _, op := range []string{">=", "<=", "==", "!=", ">", "<"} {
+		if p.consume(op) {
+			right, err := p.parseAdditive()
+			if err != nil {
+				return metricExprNode{}, err
+			}
+			sqlOp := op
+			if op == "==" {
+				sqlOp = "="
+			}
+			return metricExprNode{kind: kindCompare, op: sqlOp, args: []metricExprNode{left, right}}, nil
+		}
+	}
+	return left, nil
+}
+
+func (p *metricExprParser) parseAdditive() (metricExprNode, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return metricExprNode{}, err
+	}
+	for {
+		if p.consume("+") {
+			right, err := p.parseMultiplicative()
+			if err != nil {
+				return metricExprNode{}, err
+			}
+			left = metricExprNode{kind: kindBinary, op: "+", args: []metricExprNode{left, right}}
+			continue
+		}
+		if p.consume("-") {
+			right, err := p.parseMultiplicative()
+			if err != nil {
+				return metricExprNode{}, err
+			}
+			left = metricExprNode{kind: kindBinary, op: "-", args: []metricExprNode{left, right}}
+			continue
+		}
+		return left, nil
+	}
+}
+
+func (p *metricExprParser) parseMultiplicative() (metricExprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return metricExprNode{}, err
+	}
+	for {
+		if p.consume("*") {
+			right, err := p.parseUnary()
+			if err != nil {
+				return metricExprNode{}, err
+			}
+			left = metricExprNode{kind: kindBinary, op: "*", args: []metricExprNode{left, right}}
+			continue
+		}
+		if p.consume("/") {
+			right, err := p.parseUnary()
+			if err != nil {
+				return metricExprNode{}, err
+			}
+			left = metricExprNode{kind: kindBinary, op: "/", args: []metricExprNode{left, right}}
+			continue
+		}
+		return left, nil
+	}
+}
+
+func (p *metricExprParser) parseUnary() (metricExprNode, error) {
+	if p.consume("-") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return metricExprNode{}, err
+		}
+		return metricExprNode{kind: kindUnaryMinus, args: []metricExprNode{operand}}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *metricExprParser) parsePrimary() (metricExprNode, error) {
+	t, ok := p.peek()
+	if !ok {
+		return metricExprNode{}, errors.Errorf("unexpected end of metric expression %q", p.src)
+	}
+
+	if t.isNum {
+		p.pos++
+		return metricExprNode{kind: kindNumber, num: t.num}, nil
+	}
+
+	switch t.text {
+	case "(":
+		p.pos++
+		inner, err := p.parseExpr()
+		if err != nil {
+			return metricExprNode{}, err
+		}
+		if !p.consume(")") {
+			return metricExprNode{}, errors.Errorf("expected ')' in metric expression %q", p.src)
+		}
+		return inner, nil
+	case "min", "max":
+		p.pos++
+		if !p.consume("(") {
+			return metricExprNode{}, errors.Errorf("expected '(' after %q in metric expression %q", t.text, p.src)
+		}
+		a, err := p.parseExpr()
+		if err != nil {
+			return metricExprNode{}, err
+		}
+		if !p.consume(",") {
+			return metricExprNode{}, errors.Errorf("expected ',' in %q(...) in metric expression %q", t.text, p.src)
+		}
+		b, err := p.parseExpr()
+		if err != nil {
+			return metricExprNode{}, err
+		}
+		if !p.consume(")") {
+			return metricExprNode{}, errors.Errorf("expected ')' in metric expression %q", p.src)
+		}
+		return metricExprNode{kind: kindMinMax, op: t.text, args: []metricExprNode{a, b}}, nil
+	case "abs":
+		p.pos++
+		if !p.consume("(") {
+			return metricExprNode{}, errors.Errorf("expected '(' after 'abs' in metric expression %q", p.src)
+		}
+		a, err := p.parseExpr()
+		if err != nil {
+			return metricExprNode{}, err
+		}
+		if !p.consume(")") {
+			return metricExprNode{}, errors.Errorf("expected ')' in metric expression %q", p.src)
+		}
+		return metricExprNode{kind: kindAbs, args: []metricExprNode{a}}, nil
+	case "inf":
+		p.pos++
+		return metricExprNode{kind: kindNumber, num: math.Inf(1)}, nil
+	default:
+		for _, s := range strings.Split(t.text, ".") {
+			if s == "" || !pathSegmentRegexp.MatchString(s) {
+				return metricExprNode{}, errors.Errorf("invalid identifier %q in metric expression %q", t.text, p.src)
+			}
+		}
+		p.pos++
+		return metricExprNode{kind: kindIdent, name: t.text}, nil
+	}
+}
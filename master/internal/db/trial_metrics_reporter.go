@@ -0,0 +1,98 @@
+package db
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/determined-ai/determined/proto/pkg/trialv1"
+)
+
+// TrialMetricsReporter coalesces training metric reports over a short interval before flushing
+// them through AddTrainingMetricsBatch, so a trial runner pushing metrics every batch doesn't pay
+// a transaction round-trip per batch. One reporter is meant to be owned per trial actor for the
+// lifetime of its run.
+type TrialMetricsReporter struct {
+	db       *PgDB
+	interval time.Duration
+	reports  chan *trialv1.TrialMetrics
+	done     chan struct{}
+	closeOne sync.Once
+}
+
+// NewTrialMetricsReporter starts a reporter that flushes coalesced reports to db at most once
+// per interval.
+func NewTrialMetricsReporter(db *PgDB, interval time.Duration) *TrialMetricsReporter {
+	r := &TrialMetricsReporter{
+		db:       db,
+		interval: interval,
+		reports:  make(chan *trialv1.TrialMetrics, 256),
+		done:     make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+// Report enqueues a training metric report to be flushed on the next tick, returning false if the
+// reporter has already been closed instead of blocking forever on a channel nothing still drains.
+// The caller that owns the reporter's lifetime (e.g. a trial actor, on its own shutdown) is
+// expected to stop calling Report once it has called Close. A Report that starts after Close has
+// returned always returns false; one that runs concurrently with Close may return true for a
+// report that is never flushed.
+func (r *TrialMetricsReporter) Report(m *trialv1.TrialMetrics) bool {
+	select {
+	case <-r.done:
+		return false
+	default:
+	}
+	select {
+	case r.reports <- m:
+		return true
+	case <-r.done:
+		return false
+	}
+}
+
+// Close flushes any buffered reports and stops the reporter. It is safe to call more than once.
+func (r *TrialMetricsReporter) Close() {
+	r.closeOne.Do(func() {
+		close(r.done)
+	})
+}
+
+func (r *TrialMetricsReporter) run() {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	var buf []*trialv1.TrialMetrics
+	flush := func() {
+		if len(buf) == 0 {
+			return
+		}
+		if err := r.db.AddTrainingMetricsBatch(context.Background(), buf); err != nil {
+			log.WithError(err).Error("flushing coalesced training metrics")
+		}
+		buf = nil
+	}
+
+	for {
+		select {
+		case m := <-r.reports:
+			buf = append(buf, m)
+		case <-ticker.C:
+			flush()
+		case <-r.done:
+			for {
+				select {
+				case m := <-r.reports:
+					buf = append(buf, m)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/determined-ai/determined/proto/pkg/trialv1"
+)
+
+func TestTrialMetricsReporterCloseIsIdempotent(t *testing.T) {
+	r := NewTrialMetricsReporter(nil, time.Hour)
+	require.NotPanics(t, func() {
+		r.Close()
+		r.Close()
+	})
+}
+
+func TestTrialMetricsReporterReportAfterCloseDoesNotBlock(t *testing.T) {
+	r := NewTrialMetricsReporter(nil, time.Hour)
+	r.Close()
+
+	done := make(chan struct{})
+	var reported bool
+	go func() {
+		reported = r.Report(&trialv1.TrialMetrics{TrialId: 1})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		require.False(t, reported, "Report should signal that a post-Close report was dropped")
+	case <-time.After(time.Second):
+		t.Fatal("Report blocked after Close instead of returning")
+	}
+}
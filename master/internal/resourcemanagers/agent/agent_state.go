@@ -153,7 +153,9 @@ func (a *AgentState) Idle() bool {
 }
 
 // AllocateFreeDevices allocates container.
-func (a *AgentState) AllocateFreeDevices(slots int, cid cproto.ID) ([]device.Device, error) {
+func (a *AgentState) AllocateFreeDevices(
+	ctx context.Context, slots int, cid cproto.ID,
+) ([]device.Device, error) {
 	// TODO(ilia): Rename to AllocateContainer.
 	a.containerState[cid] = &cproto.Container{ID: cid}
 	if slots == 0 {
@@ -184,7 +186,7 @@ func (a *AgentState) AllocateFreeDevices(slots int, cid cproto.ID) ([]device.Dev
 }
 
 // DeallocateContainer deallocates containers.
-func (a *AgentState) DeallocateContainer(id cproto.ID) {
+func (a *AgentState) DeallocateContainer(ctx context.Context, id cproto.ID) {
 	delete(a.containerState, id)
 	for d, cid := range a.Devices {
 		if cid != nil && *cid == id {
@@ -211,19 +213,19 @@ func (a *AgentState) DeepCopy() *AgentState {
 }
 
 // Enable enables the agent.
-func (a *AgentState) Enable(ctx *actor.Context) {
-	ctx.Log().Infof("enabling agent: %s", a.string())
+func (a *AgentState) Enable(ctx context.Context, actorCtx *actor.Context) {
+	actorCtx.Log().Infof("enabling agent: %s", a.string())
 	a.enabled = true
 	a.draining = false
 }
 
 // Disable disables or drains the agent.
-func (a *AgentState) Disable(ctx *actor.Context, drain bool) {
+func (a *AgentState) Disable(ctx context.Context, actorCtx *actor.Context, drain bool) {
 	drainStr := "disabling"
 	if drain {
 		drainStr = "draining"
 	}
-	ctx.Log().Infof("%s agent: %s", drainStr, a.string())
+	actorCtx.Log().Infof("%s agent: %s", drainStr, a.string())
 	a.draining = drain
 	a.enabled = false
 }
@@ -239,7 +241,9 @@ func (a *AgentState) removeDevice(ctx *actor.Context, device device.Device) {
 }
 
 // agentStarted initializes slots from AgentStarted.Devices.
-func (a *AgentState) agentStarted(ctx *actor.Context, agentStarted *aproto.AgentStarted) {
+func (a *AgentState) agentStarted(
+	ctx context.Context, actorCtx *actor.Context, agentStarted *aproto.AgentStarted,
+) {
 	msg := agentStarted
 	for _, d := range msg.Devices {
 		enabled := slotEnabled{
@@ -247,19 +251,21 @@ func (a *AgentState) agentStarted(ctx *actor.Context, agentStarted *aproto.Agent
 			userEnabled:  true,
 		}
 		a.slotStates[d.ID] = &slot{enabled: enabled, device: d}
-		a.updateSlotDeviceView(ctx, d.ID)
+		a.updateSlotDeviceView(actorCtx, d.ID)
 	}
 
-	if err := a.persist(); err != nil {
-		ctx.Log().Warnf("agentStarted persist failure")
+	if err := a.persist(ctx); err != nil {
+		actorCtx.Log().Warnf("agentStarted persist failure")
 	}
 }
 
-func (a *AgentState) containerStateChanged(ctx *actor.Context, msg aproto.ContainerStateChanged) {
+func (a *AgentState) containerStateChanged(
+	ctx context.Context, actorCtx *actor.Context, msg aproto.ContainerStateChanged,
+) {
 	for _, d := range msg.Container.Devices {
 		s, ok := a.slotStates[d.ID]
 		if !ok {
-			ctx.Log().Warnf("bad containerStateChanged on device: %d (%s)", d.ID, a.string())
+			actorCtx.Log().Warnf("bad containerStateChanged on device: %d (%s)", d.ID, a.string())
 			continue
 		}
 
@@ -275,16 +281,18 @@ func (a *AgentState) containerStateChanged(ctx *actor.Context, msg aproto.Contai
 		delete(a.containerState, msg.Container.ID)
 	}
 
-	if err := a.persist(); err != nil {
-		ctx.Log().WithError(err).Warnf("containerStateChanged persist failure")
+	if err := a.persist(ctx); err != nil {
+		actorCtx.Log().WithError(err).Warnf("containerStateChanged persist failure")
 	}
 
-	if err := updateContainerState(&msg.Container); err != nil {
-		ctx.Log().WithError(err).Warnf("containerStateChanged failed to update container state")
+	if err := updateContainerState(ctx, &msg.Container); err != nil {
+		actorCtx.Log().WithError(err).Warnf("containerStateChanged failed to update container state")
 	}
 }
 
-func (a *AgentState) startContainer(ctx *actor.Context, msg sproto.StartTaskContainer) error {
+func (a *AgentState) startContainer(
+	ctx context.Context, actorCtx *actor.Context, msg sproto.StartTaskContainer,
+) error {
 	inner := func(deviceId device.ID) error {
 		s, ok := a.slotStates[deviceId]
 		if !ok {
@@ -313,12 +321,12 @@ func (a *AgentState) startContainer(ctx *actor.Context, msg sproto.StartTaskCont
 
 	a.containerAllocation[msg.Container.ID] = msg.TaskActor
 
-	if err := a.persist(); err != nil {
-		ctx.Log().WithError(err).Warnf("startContainer persist failure")
+	if err := a.persist(ctx); err != nil {
+		actorCtx.Log().WithError(err).Warnf("startContainer persist failure")
 	}
 
-	if err := updateContainerState(&msg.StartContainer.Container); err != nil {
-		ctx.Log().WithError(err).Warnf("startContainer failed to update container state")
+	if err := updateContainerState(ctx, &msg.StartContainer.Container); err != nil {
+		actorCtx.Log().WithError(err).Warnf("startContainer failed to update container state")
 	}
 
 	return nil
@@ -380,24 +388,26 @@ func (a *AgentState) updateSlotDeviceView(ctx *actor.Context, deviceID device.ID
 }
 
 func (a *AgentState) patchSlotStateInner(
-	ctx *actor.Context, msg PatchSlotState, slotState *slot) model.SlotSummary {
+	ctx context.Context, actorCtx *actor.Context, msg PatchSlotState, slotState *slot,
+) model.SlotSummary {
 	if msg.Enabled != nil {
 		slotState.enabled.userEnabled = *msg.Enabled
 	}
 	if msg.Drain != nil {
 		slotState.enabled.draining = *msg.Drain
 	}
-	a.updateSlotDeviceView(ctx, slotState.device.ID)
+	a.updateSlotDeviceView(actorCtx, slotState.device.ID)
 
 	return a.getSlotSummary(slotState.device.ID)
 }
 
 func (a *AgentState) patchAllSlotsState(
-	ctx *actor.Context, msg PatchAllSlotsState) model.SlotsSummary {
+	ctx context.Context, actorCtx *actor.Context, msg PatchAllSlotsState,
+) model.SlotsSummary {
 	result := model.SlotsSummary{}
 	for _, slotState := range a.slotStates {
 		summary := a.patchSlotStateInner(
-			ctx, PatchSlotState{
+			ctx, actorCtx, PatchSlotState{
 				ID:      slotState.device.ID, // Note: this is effectively unused.
 				Enabled: msg.Enabled,
 				Drain:   msg.Drain,
@@ -409,13 +419,14 @@ func (a *AgentState) patchAllSlotsState(
 }
 
 func (a *AgentState) patchSlotState(
-	ctx *actor.Context, msg PatchSlotState) (model.SlotSummary, error) {
+	ctx context.Context, actorCtx *actor.Context, msg PatchSlotState,
+) (model.SlotSummary, error) {
 	s, ok := a.slotStates[msg.ID]
 	if !ok {
 		return model.SlotSummary{}, errors.New(
 			fmt.Sprintf("bad updateSlotDeviceView on device: %d (%s): not found", msg.ID, a.string()))
 	}
-	return a.patchSlotStateInner(ctx, msg, s), nil
+	return a.patchSlotStateInner(ctx, actorCtx, msg, s), nil
 }
 
 func (a *AgentState) snapshot() *AgentSnapshot {
@@ -447,37 +458,29 @@ func (a *AgentState) snapshot() *AgentSnapshot {
 	return &s
 }
 
-func (a *AgentState) persist() error {
+func (a *AgentState) persist(ctx context.Context) error {
 	snapshot := a.snapshot()
 	_, err := db.Bun().NewInsert().Model(snapshot).
 		On("CONFLICT (uuid) DO UPDATE").
 		On("CONFLICT (agent_id) DO UPDATE").
-		Exec(context.TODO())
+		Exec(ctx)
 	return err
 }
 
-func (a *AgentState) restore() error {
-	snapshot := AgentSnapshot{}
-	err := db.Bun().NewSelect().Model(&snapshot).
+func (a *AgentState) delete(ctx context.Context) error {
+	_, err := db.Bun().NewDelete().Model((*AgentSnapshot)(nil)).
 		Where("agent_id = ?", a.Handler.Address().Local()).
-		Scan(context.TODO())
+		Exec(ctx)
 	if err != nil {
 		return err
 	}
-	log.Debugf("restored agent state snapshot: %v", snapshot)
-
-	return nil
-}
 
-func (a *AgentState) delete() error {
-	_, err := db.Bun().NewDelete().Model((*AgentSnapshot)(nil)).
-		Where("agent_id = ?", a.Handler.Address().Local()).
-		Exec(context.TODO())
-	return err
+	return Pool().Remove(ctx, string(a.agentID()))
 }
 
 func (a *AgentState) clearUnlessRecovered(
-	recovered map[cproto.ID]aproto.ContainerReattachAck) error {
+	ctx context.Context, recovered map[cproto.ID]aproto.ContainerReattachAck,
+) error {
 	updated := false
 	for d := range a.Devices {
 		if cID := a.Devices[d]; cID != nil {
@@ -517,7 +520,7 @@ func (a *AgentState) clearUnlessRecovered(
 	}
 
 	if updated {
-		return a.persist()
+		return a.persist(ctx)
 	}
 
 	return nil
@@ -536,8 +539,10 @@ func listResourcePoolsWithReattachEnabled() []string {
 }
 
 // retrieveAgentStates reconstructs AgentStates from the database for all resource pools that
-// have agent_container_reattachment enabled.
-func retrieveAgentStates() (map[AgentID]AgentState, error) {
+// have agent_container_reattachment enabled. The supplied context is propagated to every
+// underlying query, so a canceled reattach request aborts this scan instead of blocking the
+// master until Postgres replies.
+func retrieveAgentStates(ctx context.Context) (map[AgentID]AgentState, error) {
 	rpNames := listResourcePoolsWithReattachEnabled()
 
 	if len(rpNames) == 0 {
@@ -547,15 +552,46 @@ func retrieveAgentStates() (map[AgentID]AgentState, error) {
 	snapshots := []AgentSnapshot{}
 	err := db.Bun().NewSelect().Model(&snapshots).
 		Where("resource_pool_name IN (?)", bun.In(rpNames)).
-		Scan(context.TODO())
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := hydrateAgentStates(ctx, snapshots, newAgentStateFromSnapshot)
 	if err != nil {
 		return nil, err
 	}
 
+	// Feed every reattached agent into the process-wide Pool, so it's available through the
+	// Driver interface the moment hydration finishes rather than only ever existing as a
+	// map entry callers have to know to reach into directly.
+	for id, state := range result {
+		state := state
+		if err := Pool().Add(ctx, string(id), &state); err != nil {
+			return nil, fmt.Errorf("registering reattached agent %s with pool: %w", id, err)
+		}
+	}
+
+	return result, nil
+}
+
+// hydrateAgentStates calls newState once per snapshot, checking ctx before each call so a
+// canceled reattach request aborts the scan after its current snapshot instead of plowing through
+// every remaining one. It's factored out of retrieveAgentStates so tests can substitute newState
+// with a slow stand-in and observe cancellation without a real database.
+func hydrateAgentStates(
+	ctx context.Context,
+	snapshots []AgentSnapshot,
+	newState func(ctx context.Context, s AgentSnapshot) (*AgentState, error),
+) (map[AgentID]AgentState, error) {
 	result := make(map[AgentID]AgentState, len(snapshots))
 
 	for _, s := range snapshots {
-		state, err := newAgentStateFromSnapshot(s)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		state, err := newState(ctx, s)
 		if err != nil {
 			return nil, fmt.Errorf("failed to recreate agent state %s: %w", s.AgentID, err)
 		}
@@ -566,10 +602,23 @@ func retrieveAgentStates() (map[AgentID]AgentState, error) {
 	return result, nil
 }
 
-func newAgentStateFromSnapshot(as AgentSnapshot) (*AgentState, error) {
+func newAgentStateFromSnapshot(ctx context.Context, as AgentSnapshot) (*AgentState, error) {
+	result := &AgentState{containerAllocation: make(map[cproto.ID]*actor.Ref)}
+	if err := result.applySnapshot(ctx, as); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// applySnapshot overwrites a's persisted fields (slots, devices, container state, resource pool
+// membership, ...) with what's recorded in as. It's the single place that turns an AgentSnapshot
+// back into live AgentState, shared by newAgentStateFromSnapshot (cold-start hydration, reading
+// from the database) and Restore (resourceprovider.Driver's reattach path, reading the snapshot
+// the caller already has in hand).
+func (a *AgentState) applySnapshot(ctx context.Context, as AgentSnapshot) error {
 	parsedUUID, err := uuid.Parse(as.UUID)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	slotStates := make(map[device.ID]*slot)
@@ -599,9 +648,9 @@ func newAgentStateFromSnapshot(as AgentSnapshot) (*AgentState, error) {
 		containerSnapshots := make([]ContainerSnapshot, 0, len(as.Containers))
 		err := db.Bun().NewSelect().Model(&containerSnapshots).
 			Where("container_id IN (?)", bun.In(as.Containers)).
-			Scan(context.TODO())
+			Scan(ctx)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
 		for _, containerSnapshot := range containerSnapshots {
@@ -610,26 +659,23 @@ func newAgentStateFromSnapshot(as AgentSnapshot) (*AgentState, error) {
 		}
 	}
 
-	result := AgentState{
-		maxZeroSlotContainers: as.MaxZeroSlotContainers,
-		resourcePoolName:      as.ResourcePoolName,
-		Label:                 as.Label,
-		uuid:                  parsedUUID,
-		enabled:               as.UserEnabled,
-		draining:              as.UserDraining,
-		slotStates:            slotStates,
-		Devices:               devices,
-		containerAllocation:   make(map[cproto.ID]*actor.Ref),
-		containerState:        containerState,
-	}
+	a.maxZeroSlotContainers = as.MaxZeroSlotContainers
+	a.resourcePoolName = as.ResourcePoolName
+	a.Label = as.Label
+	a.uuid = parsedUUID
+	a.enabled = as.UserEnabled
+	a.draining = as.UserDraining
+	a.slotStates = slotStates
+	a.Devices = devices
+	a.containerState = containerState
 
-	return &result, nil
+	return nil
 }
 
-func (a *AgentState) restoreContainersField() error {
+func (a *AgentState) restoreContainersField(ctx context.Context) error {
 	containerIDs := maps.Keys(a.containerState)
 
-	c2a, err := loadContainersToAllocationIds(containerIDs)
+	c2a, err := loadContainersToAllocationIds(ctx, containerIDs)
 	if err != nil {
 		return err
 	}
@@ -648,24 +694,25 @@ func (a *AgentState) restoreContainersField() error {
 	return nil
 }
 
-func clearAgentStates(agentIds []AgentID) error {
-	_, err := db.Bun().NewDelete().Where("agent_id in (?)", agentIds).Exec(context.TODO())
+func clearAgentStates(ctx context.Context, agentIds []AgentID) error {
+	_, err := db.Bun().NewDelete().Where("agent_id in (?)", agentIds).Exec(ctx)
 
 	return err
 }
 
-func updateContainerState(c *cproto.Container) error {
+func updateContainerState(ctx context.Context, c *cproto.Container) error {
 	snapshot := NewContainerSnapshot(c)
 	_, err := db.Bun().NewUpdate().Model(&snapshot).
 		Where("container_id = ?", snapshot.ID).
 		Column("state", "devices").
-		Exec(context.TODO())
+		Exec(ctx)
 
 	return err
 }
 
 func loadContainersToAllocationIds(
-	containerIDs []cproto.ID) (map[cproto.ID]model.AllocationID, error) {
+	ctx context.Context, containerIDs []cproto.ID,
+) (map[cproto.ID]model.AllocationID, error) {
 	cs := []ContainerSnapshot{}
 	result := []map[string]interface{}{}
 	rr := map[cproto.ID]model.AllocationID{}
@@ -678,7 +725,7 @@ func loadContainersToAllocationIds(
 		Join("JOIN allocation_resources al_res ON al_res.resource_id = rmac.resource_id").
 		Where("container_id IN (?)", bun.In(containerIDs)).
 		Column("container_id", "allocation_id").
-		Scan(context.TODO(), &result)
+		Scan(ctx, &result)
 	if err != nil {
 		return nil, err
 	}
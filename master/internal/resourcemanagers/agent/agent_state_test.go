@@ -0,0 +1,69 @@
+package agent
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHydrateAgentStatesAbortsOnCancellation(t *testing.T) {
+	snapshots := []AgentSnapshot{
+		{AgentID: "agent-1"}, {AgentID: "agent-2"}, {AgentID: "agent-3"},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var calls int32
+	newState := func(ctx context.Context, s AgentSnapshot) (*AgentState, error) {
+		atomic.AddInt32(&calls, 1)
+		// Cancel partway through, simulating a slow underlying query being aborted by the
+		// caller while more snapshots remain to process.
+		cancel()
+		return &AgentState{}, nil
+	}
+
+	_, err := hydrateAgentStates(ctx, snapshots, newState)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, int32(1), atomic.LoadInt32(&calls),
+		"hydrateAgentStates should stop at the next snapshot once ctx is canceled, "+
+			"not process every remaining one")
+}
+
+func TestHydrateAgentStatesCompletesWithoutCancellation(t *testing.T) {
+	snapshots := []AgentSnapshot{{AgentID: "agent-1"}, {AgentID: "agent-2"}}
+
+	newState := func(ctx context.Context, s AgentSnapshot) (*AgentState, error) {
+		return &AgentState{resourcePoolName: "default"}, nil
+	}
+
+	result, err := hydrateAgentStates(context.Background(), snapshots, newState)
+	require.NoError(t, err)
+	require.Len(t, result, 2)
+}
+
+// TestHydrateAgentStatesCancellationDuringSlowQuery demonstrates that a context canceled while
+// newState is still in flight (e.g. a slow Postgres query) surfaces as hydrateAgentStates' error,
+// wrapping context.Canceled, rather than the cancellation being silently dropped.
+func TestHydrateAgentStatesCancellationDuringSlowQuery(t *testing.T) {
+	snapshots := []AgentSnapshot{{AgentID: "agent-1"}, {AgentID: "agent-2"}}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	newState := func(ctx context.Context, s AgentSnapshot) (*AgentState, error) {
+		if s.AgentID == "agent-1" {
+			go func() {
+				time.Sleep(10 * time.Millisecond)
+				cancel()
+			}()
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return &AgentState{}, nil
+	}
+
+	_, err := hydrateAgentStates(ctx, snapshots, newState)
+	require.ErrorIs(t, err, context.Canceled)
+}
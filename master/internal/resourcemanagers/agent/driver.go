@@ -0,0 +1,102 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/determined-ai/determined/master/pkg/aproto"
+	"github.com/determined-ai/determined/master/pkg/cproto"
+	"github.com/determined-ai/determined/master/pkg/device"
+	"github.com/determined-ai/determined/master/pkg/model"
+
+	"github.com/determined-ai/determined/master/internal/resourcemanagers/resourceprovider"
+)
+
+// driverType identifies AgentState's persisted snapshots as belonging to the container-agent
+// driver, distinguishing them from other resourceprovider.Driver implementations (e.g. k8spod)
+// that may eventually share a resource pool.
+const driverType = "container-agent"
+
+// DriverType implements resourceprovider.DriverSnapshot.
+func (s *AgentSnapshot) DriverType() string {
+	return driverType
+}
+
+var _ resourceprovider.Driver = (*AgentState)(nil)
+
+// Start is a no-op for the container-agent driver: the underlying TCP/websocket connection is
+// owned and lifecycle-managed by the agent actor itself, not by AgentState.
+func (a *AgentState) Start(ctx context.Context) error {
+	return nil
+}
+
+// Stop is a no-op for the container-agent driver; see Start.
+func (a *AgentState) Stop(ctx context.Context) error {
+	return nil
+}
+
+// AllocateResources implements resourceprovider.Driver by delegating to AllocateFreeDevices.
+func (a *AgentState) AllocateResources(
+	ctx context.Context, slots int, id cproto.ID,
+) ([]device.Device, error) {
+	return a.AllocateFreeDevices(ctx, slots, id)
+}
+
+// DeallocateResources implements resourceprovider.Driver by delegating to DeallocateContainer.
+func (a *AgentState) DeallocateResources(ctx context.Context, id cproto.ID) error {
+	a.DeallocateContainer(ctx, id)
+	return nil
+}
+
+// SlotsSummary implements resourceprovider.Driver. It mirrors getSlotsSummary but keys slots off
+// the agent's handler address directly, since the driver interface has no actor.Context to pull
+// the address from.
+func (a *AgentState) SlotsSummary(ctx context.Context) model.SlotsSummary {
+	summary := make(model.SlotsSummary, len(a.slotStates))
+	for deviceID := range a.slotStates {
+		summary[fmt.Sprintf("%s/slots/%d", a.Handler.Address(), deviceID)] = a.getSlotSummary(deviceID)
+	}
+
+	return summary
+}
+
+// Snapshot implements resourceprovider.Driver.
+func (a *AgentState) Snapshot(ctx context.Context) (resourceprovider.DriverSnapshot, error) {
+	return a.snapshot(), nil
+}
+
+// Restore implements resourceprovider.Driver by applying the given snapshot directly, rather
+// than re-querying the database for it: the caller (the reattach path driving the Driver
+// interface) already has it in hand, and re-fetching by agent_id would silently ignore whatever
+// snapshot was actually passed in.
+func (a *AgentState) Restore(ctx context.Context, snapshot resourceprovider.DriverSnapshot) error {
+	as, ok := snapshot.(*AgentSnapshot)
+	if !ok {
+		return fmt.Errorf("container-agent driver cannot restore a %s snapshot", snapshot.DriverType())
+	}
+	return a.applySnapshot(ctx, *as)
+}
+
+// Reattach implements resourceprovider.Driver by delegating to clearUnlessRecovered.
+func (a *AgentState) Reattach(
+	ctx context.Context, recovered map[cproto.ID]aproto.ContainerReattachAck,
+) error {
+	return a.clearUnlessRecovered(ctx, recovered)
+}
+
+// RegisterDriverFactory makes pool able to restore container-agent snapshots, reconstructing an
+// AgentState driver from a persisted AgentSnapshot via the same applySnapshot path
+// newAgentStateFromSnapshot uses. The process-wide Pool() calls this on first use; any other
+// Pool restores container-agent snapshots only after being passed here (k8spod.RegisterDriverFactory
+// is the k8s-pod counterpart).
+func RegisterDriverFactory(pool *resourceprovider.Pool) {
+	pool.RegisterFactory(driverType, func(
+		ctx context.Context, snapshot resourceprovider.DriverSnapshot,
+	) (resourceprovider.Driver, error) {
+		as, ok := snapshot.(*AgentSnapshot)
+		if !ok {
+			return nil, fmt.Errorf("container-agent driver cannot restore a %s snapshot", snapshot.DriverType())
+		}
+		return newAgentStateFromSnapshot(ctx, *as)
+	})
+}
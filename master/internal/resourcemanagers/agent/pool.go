@@ -0,0 +1,26 @@
+package agent
+
+import (
+	"sync"
+
+	"github.com/determined-ai/determined/master/internal/resourcemanagers/resourceprovider"
+)
+
+// pool is the process-wide resourceprovider.Pool that retrieveAgentStates populates with every
+// agent reattached at startup, and that delete removes an agent from when it's torn down. It's
+// the one place a caller can deal with agents purely through the Driver interface instead of
+// reaching into AgentState directly.
+var (
+	poolOnce sync.Once
+	poolVal  *resourceprovider.Pool
+)
+
+// Pool returns the process-wide agent resourceprovider.Pool, registering the container-agent
+// driver factory against it on first use.
+func Pool() *resourceprovider.Pool {
+	poolOnce.Do(func() {
+		poolVal = resourceprovider.NewPool()
+		RegisterDriverFactory(poolVal)
+	})
+	return poolVal
+}
@@ -0,0 +1,209 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// AgentStateStore is the in-memory, authoritative cache of AgentState keyed by AgentID. Reads are
+// served entirely from the sync.Map; Postgres is only consulted once, to hydrate the cache on
+// construction (e.g. after a master restart), and afterwards serves purely as a durability
+// backing written to via coalesced, debounced flushes. This mirrors the pattern VOLTHA's
+// DeviceManager uses to keep its device agents authoritative in memory with the KV store as a
+// durability tier.
+type AgentStateStore struct {
+	states sync.Map // AgentID -> *AgentState
+
+	flushInterval time.Duration
+
+	pendingMu sync.Mutex
+	pending   map[AgentID]*time.Timer
+
+	// persistFn and deleteFn are indirections over AgentState.persist/clearAgentStates so tests
+	// can observe flush behavior without a real database.
+	persistFn func(ctx context.Context, state *AgentState) error
+	deleteFn  func(ctx context.Context, id AgentID) error
+
+	metrics agentStateStoreMetrics
+}
+
+type agentStateStoreMetrics struct {
+	coalescedUpserts int64
+	flushes          int64
+	flushErrors      int64
+	flushNanos       int64
+}
+
+// AgentStateStoreMetrics reports write-coalescing behavior for monitoring.
+type AgentStateStoreMetrics struct {
+	// CoalescedUpserts counts debounced Upsert calls folded into an already-scheduled flush
+	// instead of triggering one of their own.
+	CoalescedUpserts int64
+	// Flushes counts persist attempts the store has issued.
+	Flushes int64
+	// FlushErrors counts flushes that returned an error.
+	FlushErrors int64
+	// FlushLatency is the cumulative time spent inside persist across all flushes.
+	FlushLatency time.Duration
+}
+
+var (
+	storeOnce sync.Once
+	storeVal  *AgentStateStore
+	storeErr  error
+)
+
+// Store returns the process-wide AgentStateStore, hydrating it from Postgres via
+// NewAgentStateStore on the first call and returning the same cache on every call after that.
+// This is what lets retrieveAgentStates's one-time-scan cost actually be paid once per process
+// instead of once per caller: everything after the first Store call is served from memory.
+func Store(ctx context.Context, flushInterval time.Duration) (*AgentStateStore, error) {
+	storeOnce.Do(func() {
+		storeVal, storeErr = NewAgentStateStore(ctx, flushInterval)
+	})
+	return storeVal, storeErr
+}
+
+// NewAgentStateStore hydrates an AgentStateStore from the database and returns it. Writes after
+// construction flush at most once per flushInterval per agent, except where callers request an
+// immediate flush (e.g. on enable/disable/terminate).
+func NewAgentStateStore(ctx context.Context, flushInterval time.Duration) (*AgentStateStore, error) {
+	hydrated, err := retrieveAgentStates(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	store := newAgentStateStore(flushInterval)
+	for id, state := range hydrated {
+		state := state
+		store.states.Store(id, &state)
+	}
+
+	return store, nil
+}
+
+func newAgentStateStore(flushInterval time.Duration) *AgentStateStore {
+	return &AgentStateStore{
+		flushInterval: flushInterval,
+		pending:       make(map[AgentID]*time.Timer),
+		persistFn: func(ctx context.Context, state *AgentState) error {
+			return state.persist(ctx)
+		},
+		deleteFn: func(ctx context.Context, id AgentID) error {
+			return clearAgentStates(ctx, []AgentID{id})
+		},
+	}
+}
+
+// Get returns the cached state for id, if any.
+func (s *AgentStateStore) Get(id AgentID) (*AgentState, bool) {
+	v, ok := s.states.Load(id)
+	if !ok {
+		return nil, false
+	}
+	return v.(*AgentState), true
+}
+
+// List returns a snapshot of every cached agent's state.
+func (s *AgentStateStore) List() map[AgentID]*AgentState {
+	result := map[AgentID]*AgentState{}
+	s.states.Range(func(key, value interface{}) bool {
+		result[key.(AgentID)] = value.(*AgentState)
+		return true
+	})
+	return result
+}
+
+// Upsert stores state as the authoritative copy for id and flushes it to Postgres, either
+// immediately or after being coalesced with other pending writes within flushInterval.
+func (s *AgentStateStore) Upsert(
+	ctx context.Context, id AgentID, state *AgentState, immediate bool,
+) error {
+	s.states.Store(id, state)
+
+	if immediate {
+		s.cancelPending(id)
+		return s.flushNow(ctx, id)
+	}
+
+	s.scheduleFlush(id)
+	return nil
+}
+
+// Delete evicts id from the cache, cancels any pending debounced flush, and removes its
+// persisted snapshot.
+func (s *AgentStateStore) Delete(ctx context.Context, id AgentID) error {
+	s.cancelPending(id)
+	s.states.Delete(id)
+	return s.deleteFn(ctx, id)
+}
+
+// Snapshot returns the persistable snapshot of every cached agent, computed from memory.
+func (s *AgentStateStore) Snapshot(ctx context.Context) []*AgentSnapshot {
+	result := make([]*AgentSnapshot, 0)
+	s.states.Range(func(_, value interface{}) bool {
+		result = append(result, value.(*AgentState).snapshot())
+		return true
+	})
+	return result
+}
+
+// Metrics returns a point-in-time view of write-coalescing counters.
+func (s *AgentStateStore) Metrics() AgentStateStoreMetrics {
+	return AgentStateStoreMetrics{
+		CoalescedUpserts: atomic.LoadInt64(&s.metrics.coalescedUpserts),
+		Flushes:          atomic.LoadInt64(&s.metrics.flushes),
+		FlushErrors:      atomic.LoadInt64(&s.metrics.flushErrors),
+		FlushLatency:     time.Duration(atomic.LoadInt64(&s.metrics.flushNanos)),
+	}
+}
+
+func (s *AgentStateStore) scheduleFlush(id AgentID) {
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+
+	if _, scheduled := s.pending[id]; scheduled {
+		atomic.AddInt64(&s.metrics.coalescedUpserts, 1)
+		return
+	}
+
+	s.pending[id] = time.AfterFunc(s.flushInterval, func() {
+		s.pendingMu.Lock()
+		delete(s.pending, id)
+		s.pendingMu.Unlock()
+
+		if err := s.flushNow(context.Background(), id); err != nil {
+			log.WithError(err).WithField("agent-id", id).Warn("agent state store: debounced flush failed")
+		}
+	})
+}
+
+func (s *AgentStateStore) cancelPending(id AgentID) {
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+
+	if t, ok := s.pending[id]; ok {
+		t.Stop()
+		delete(s.pending, id)
+	}
+}
+
+func (s *AgentStateStore) flushNow(ctx context.Context, id AgentID) error {
+	state, ok := s.Get(id)
+	if !ok {
+		return nil
+	}
+
+	start := time.Now()
+	err := s.persistFn(ctx, state)
+	atomic.AddInt64(&s.metrics.flushes, 1)
+	atomic.AddInt64(&s.metrics.flushNanos, int64(time.Since(start)))
+	if err != nil {
+		atomic.AddInt64(&s.metrics.flushErrors, 1)
+	}
+	return err
+}
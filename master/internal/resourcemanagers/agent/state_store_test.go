@@ -0,0 +1,97 @@
+package agent
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgentStateStoreCoalescesDebouncedUpserts(t *testing.T) {
+	store := newAgentStateStore(time.Hour) // long enough that the timer never actually fires here
+
+	var persisted int32
+	store.persistFn = func(ctx context.Context, state *AgentState) error {
+		atomic.AddInt32(&persisted, 1)
+		return nil
+	}
+
+	id := AgentID("agent-1")
+	first := &AgentState{resourcePoolName: "default"}
+	second := &AgentState{resourcePoolName: "default", draining: true}
+
+	require.NoError(t, store.Upsert(context.Background(), id, first, false))
+	require.NoError(t, store.Upsert(context.Background(), id, second, false))
+
+	// A crash "mid-debounce" is simulated by tearing the store down (canceling the pending
+	// timer) before it fires: at most the latest coalesced transition is lost, never persisted.
+	store.cancelPending(id)
+
+	require.Equal(t, int32(0), atomic.LoadInt32(&persisted), "debounced flush should not have fired yet")
+	require.Equal(t, int64(1), store.Metrics().CoalescedUpserts, "second upsert should have coalesced")
+
+	cached, ok := store.Get(id)
+	require.True(t, ok)
+	require.Same(t, second, cached, "store should retain the latest transition even though it was never flushed")
+}
+
+func TestAgentStateStoreImmediateUpsertFlushesNow(t *testing.T) {
+	store := newAgentStateStore(time.Hour)
+
+	var persisted int32
+	store.persistFn = func(ctx context.Context, state *AgentState) error {
+		atomic.AddInt32(&persisted, 1)
+		return nil
+	}
+
+	id := AgentID("agent-1")
+	state := &AgentState{resourcePoolName: "default", enabled: true}
+
+	require.NoError(t, store.Upsert(context.Background(), id, state, true))
+
+	require.Equal(t, int32(1), atomic.LoadInt32(&persisted))
+	require.Equal(t, int64(1), store.Metrics().Flushes)
+}
+
+func TestAgentStateStoreServesReattachFromHydratedView(t *testing.T) {
+	store := newAgentStateStore(time.Hour)
+
+	// Simulate cold-start hydration from the database without touching Postgres: the store's
+	// constructor just seeds the sync.Map from retrieveAgentStates, so we do the same here.
+	id := AgentID("agent-1")
+	hydrated := &AgentState{resourcePoolName: "default", enabled: true}
+	store.states.Store(id, hydrated)
+
+	cached, ok := store.Get(id)
+	require.True(t, ok)
+	require.Same(t, hydrated, cached, "reattach should read the hydrated state, not re-query the database")
+
+	listed := store.List()
+	require.Len(t, listed, 1)
+	require.Same(t, hydrated, listed[id])
+}
+
+func TestAgentStateStoreDeleteCancelsPendingFlush(t *testing.T) {
+	store := newAgentStateStore(time.Hour)
+
+	var persisted, deleted int32
+	store.persistFn = func(ctx context.Context, state *AgentState) error {
+		atomic.AddInt32(&persisted, 1)
+		return nil
+	}
+	store.deleteFn = func(ctx context.Context, id AgentID) error {
+		atomic.AddInt32(&deleted, 1)
+		return nil
+	}
+
+	id := AgentID("agent-1")
+	require.NoError(t, store.Upsert(context.Background(), id, &AgentState{}, false))
+	require.NoError(t, store.Delete(context.Background(), id))
+
+	_, ok := store.Get(id)
+	require.False(t, ok)
+	require.Equal(t, int32(1), atomic.LoadInt32(&deleted))
+	require.Equal(t, int32(0), atomic.LoadInt32(&persisted), "the canceled debounced flush should never fire")
+}
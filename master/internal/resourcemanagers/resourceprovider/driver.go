@@ -0,0 +1,50 @@
+// Package resourceprovider defines the seam between the scheduler and the concrete backends
+// that actually own compute resources (container agents, Kubernetes pods, Slurm nodes, and
+// eventually VM-style workers). Today the scheduler talks directly to agent.AgentState, which
+// hard-codes the container-agent protocol; Driver lets additional backends implement the same
+// contract so a resource pool isn't permanently wedded to one of them.
+package resourceprovider
+
+import (
+	"context"
+
+	"github.com/determined-ai/determined/master/pkg/aproto"
+	"github.com/determined-ai/determined/master/pkg/cproto"
+	"github.com/determined-ai/determined/master/pkg/device"
+	"github.com/determined-ai/determined/master/pkg/model"
+)
+
+// DriverSnapshot is an opaque, driver-specific persisted representation of a Driver's state.
+// Each implementation defines its own concrete type; the persistence layer tags rows with
+// DriverType so multiple drivers can coexist side by side in one resource pool.
+type DriverSnapshot interface {
+	DriverType() string
+}
+
+// Driver is implemented by every resource backend the scheduler can allocate from. Methods
+// mirror the lifecycle agent.AgentState already has for container agents: bring the backend up,
+// allocate/deallocate against it, report slot state, and persist/restore/reattach across master
+// restarts.
+type Driver interface {
+	// Start brings up the driver's connection to its backend (e.g. registers an agent, opens a
+	// pod watch).
+	Start(ctx context.Context) error
+	// Stop tears the driver down, releasing any resources it holds.
+	Stop(ctx context.Context) error
+
+	// AllocateResources reserves slots (and, if slots is 0, a zero-slot unit) for id.
+	AllocateResources(ctx context.Context, slots int, id cproto.ID) ([]device.Device, error)
+	// DeallocateResources releases resources previously granted to id.
+	DeallocateResources(ctx context.Context, id cproto.ID) error
+
+	// SlotsSummary reports the current state of every slot the driver manages.
+	SlotsSummary(ctx context.Context) model.SlotsSummary
+
+	// Snapshot serializes the driver's state for persistence.
+	Snapshot(ctx context.Context) (DriverSnapshot, error)
+	// Restore reconstructs driver state from a previously persisted snapshot.
+	Restore(ctx context.Context, snapshot DriverSnapshot) error
+	// Reattach reconciles in-memory state against whatever the backend reports as still running
+	// after a master restart, clearing anything not in recovered.
+	Reattach(ctx context.Context, recovered map[cproto.ID]aproto.ContainerReattachAck) error
+}
@@ -0,0 +1,101 @@
+// Package k8spod is a stub resourceprovider.Driver implementation for Kubernetes pod-backed
+// resource pools. It exists to prove out the Driver seam against a second backend; none of the
+// pod lifecycle is wired up yet.
+package k8spod
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/determined-ai/determined/master/pkg/aproto"
+	"github.com/determined-ai/determined/master/pkg/cproto"
+	"github.com/determined-ai/determined/master/pkg/device"
+	"github.com/determined-ai/determined/master/pkg/model"
+
+	"github.com/determined-ai/determined/master/internal/resourcemanagers/resourceprovider"
+)
+
+const driverType = "k8s-pod"
+
+// Snapshot is the k8spod driver's persisted state. It is empty for now; pod identity and slot
+// bookkeeping will land alongside the real implementation.
+type Snapshot struct{}
+
+// DriverType implements resourceprovider.DriverSnapshot.
+func (Snapshot) DriverType() string {
+	return driverType
+}
+
+// Driver is an unimplemented resourceprovider.Driver for Kubernetes pods.
+type Driver struct {
+	poolName string
+}
+
+var _ resourceprovider.Driver = (*Driver)(nil)
+
+// New returns a k8spod Driver for the named resource pool.
+func New(poolName string) *Driver {
+	return &Driver{poolName: poolName}
+}
+
+// Start is not yet implemented.
+func (d *Driver) Start(ctx context.Context) error {
+	return fmt.Errorf("k8spod driver not implemented for pool %q", d.poolName)
+}
+
+// Stop is not yet implemented.
+func (d *Driver) Stop(ctx context.Context) error {
+	return nil
+}
+
+// AllocateResources is not yet implemented.
+func (d *Driver) AllocateResources(
+	ctx context.Context, slots int, id cproto.ID,
+) ([]device.Device, error) {
+	return nil, fmt.Errorf("k8spod driver does not support AllocateResources yet")
+}
+
+// DeallocateResources is not yet implemented.
+func (d *Driver) DeallocateResources(ctx context.Context, id cproto.ID) error {
+	return fmt.Errorf("k8spod driver does not support DeallocateResources yet")
+}
+
+// SlotsSummary always reports no slots until pod discovery is implemented.
+func (d *Driver) SlotsSummary(ctx context.Context) model.SlotsSummary {
+	return model.SlotsSummary{}
+}
+
+// Snapshot returns the (currently empty) k8spod snapshot.
+func (d *Driver) Snapshot(ctx context.Context) (resourceprovider.DriverSnapshot, error) {
+	return Snapshot{}, nil
+}
+
+// Restore is not yet implemented.
+func (d *Driver) Restore(ctx context.Context, snapshot resourceprovider.DriverSnapshot) error {
+	if _, ok := snapshot.(Snapshot); !ok {
+		return fmt.Errorf("k8spod driver cannot restore a %s snapshot", snapshot.DriverType())
+	}
+	return nil
+}
+
+// Reattach is not yet implemented.
+func (d *Driver) Reattach(
+	ctx context.Context, recovered map[cproto.ID]aproto.ContainerReattachAck,
+) error {
+	return nil
+}
+
+// RegisterDriverFactory makes pool able to restore k8s-pod snapshots. Snapshot records no pool
+// name, so the restored Driver has an empty pool name. No resource pool setup code calls it; a
+// Pool restores k8s-pod snapshots only after being passed here (agent.RegisterDriverFactory is
+// the container-agent counterpart).
+func RegisterDriverFactory(pool *resourceprovider.Pool) {
+	pool.RegisterFactory(driverType, func(
+		ctx context.Context, snapshot resourceprovider.DriverSnapshot,
+	) (resourceprovider.Driver, error) {
+		if _, ok := snapshot.(Snapshot); !ok {
+			return nil, fmt.Errorf("k8spod driver cannot restore a %s snapshot", snapshot.DriverType())
+		}
+		return New(""), nil
+	})
+}
@@ -0,0 +1,184 @@
+package resourceprovider
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/determined-ai/determined/master/pkg/aproto"
+	"github.com/determined-ai/determined/master/pkg/cproto"
+	"github.com/determined-ai/determined/master/pkg/device"
+	"github.com/determined-ai/determined/master/pkg/model"
+)
+
+// DriverFactory constructs a Driver for a previously persisted snapshot, so Pool can dispatch a
+// restored snapshot back to whichever concrete implementation produced it; Pool.Restore then
+// calls Restore on the returned Driver with the same snapshot. Each
+// Driver implementation (agent.AgentState, k8spod.Driver, ...) registers its own factory under
+// its DriverType.
+type DriverFactory func(ctx context.Context, snapshot DriverSnapshot) (Driver, error)
+
+// Pool holds every Driver live in a single resource pool and drives them all through the common
+// Driver interface, so a pool isn't permanently wedded to one backend: container agents, k8s
+// pods, and future backends can coexist side by side, keyed by the driver-assigned ID (e.g.
+// agent ID, pod UID). This is the seam the scheduler is meant to depend on instead of reaching
+// into agent.AgentState directly.
+type Pool struct {
+	mu sync.Mutex
+
+	drivers   map[string]Driver
+	factories map[string]DriverFactory
+}
+
+// NewPool returns an empty Pool.
+func NewPool() *Pool {
+	return &Pool{
+		drivers:   make(map[string]Driver),
+		factories: make(map[string]DriverFactory),
+	}
+}
+
+// RegisterFactory makes driverType snapshots restorable by this Pool. Driver implementations
+// call this (typically from an init-time or resource-pool-setup hook) to opt in to Restore.
+func (p *Pool) RegisterFactory(driverType string, factory DriverFactory) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.factories[driverType] = factory
+}
+
+// Add registers a live Driver under id, starting it.
+func (p *Pool) Add(ctx context.Context, id string, d Driver) error {
+	if err := d.Start(ctx); err != nil {
+		return fmt.Errorf("starting driver %q: %w", id, err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.drivers[id] = d
+	return nil
+}
+
+// Remove stops and forgets the driver registered under id, if any.
+func (p *Pool) Remove(ctx context.Context, id string) error {
+	p.mu.Lock()
+	d, ok := p.drivers[id]
+	delete(p.drivers, id)
+	p.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+	return d.Stop(ctx)
+}
+
+// AllocateResources asks the named driver to allocate slots for id, delegating through the
+// Driver interface rather than assuming a concrete backend.
+func (p *Pool) AllocateResources(
+	ctx context.Context, driverID string, slots int, id cproto.ID,
+) ([]device.Device, error) {
+	d, ok := p.driver(driverID)
+	if !ok {
+		return nil, fmt.Errorf("no driver registered for %q", driverID)
+	}
+	return d.AllocateResources(ctx, slots, id)
+}
+
+// DeallocateResources releases resources previously granted to id on the named driver.
+func (p *Pool) DeallocateResources(ctx context.Context, driverID string, id cproto.ID) error {
+	d, ok := p.driver(driverID)
+	if !ok {
+		return fmt.Errorf("no driver registered for %q", driverID)
+	}
+	return d.DeallocateResources(ctx, id)
+}
+
+// SlotsSummary merges the slot state reported by every driver currently in the pool.
+func (p *Pool) SlotsSummary(ctx context.Context) model.SlotsSummary {
+	p.mu.Lock()
+	drivers := make([]Driver, 0, len(p.drivers))
+	for _, d := range p.drivers {
+		drivers = append(drivers, d)
+	}
+	p.mu.Unlock()
+
+	summary := make(model.SlotsSummary)
+	for _, d := range drivers {
+		for k, v := range d.SlotsSummary(ctx) {
+			summary[k] = v
+		}
+	}
+	return summary
+}
+
+// Snapshot serializes every driver currently in the pool, keyed by its driver ID, for
+// persistence. Each value's DriverType records which backend produced it.
+func (p *Pool) Snapshot(ctx context.Context) (map[string]DriverSnapshot, error) {
+	p.mu.Lock()
+	drivers := make(map[string]Driver, len(p.drivers))
+	for id, d := range p.drivers {
+		drivers[id] = d
+	}
+	p.mu.Unlock()
+
+	snapshots := make(map[string]DriverSnapshot, len(drivers))
+	for id, d := range drivers {
+		snapshot, err := d.Snapshot(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("snapshotting driver %q: %w", id, err)
+		}
+		snapshots[id] = snapshot
+	}
+	return snapshots, nil
+}
+
+// Restore reconstructs and registers a Driver for each snapshot, dispatching to the factory
+// registered under the snapshot's DriverType. This is what lets a single resource pool persist
+// and reattach a mix of driver types rather than assuming every row is the same backend.
+func (p *Pool) Restore(ctx context.Context, snapshots map[string]DriverSnapshot) error {
+	for id, snapshot := range snapshots {
+		p.mu.Lock()
+		factory, ok := p.factories[snapshot.DriverType()]
+		p.mu.Unlock()
+		if !ok {
+			return fmt.Errorf("no driver factory registered for snapshot type %q", snapshot.DriverType())
+		}
+
+		d, err := factory(ctx, snapshot)
+		if err != nil {
+			return fmt.Errorf("restoring driver %q: %w", id, err)
+		}
+		if err := d.Restore(ctx, snapshot); err != nil {
+			return fmt.Errorf("restoring driver %q: %w", id, err)
+		}
+
+		p.mu.Lock()
+		p.drivers[id] = d
+		p.mu.Unlock()
+	}
+	return nil
+}
+
+// Reattach reconciles every driver in the pool against recovered, clearing anything not
+// reported as still running.
+func (p *Pool) Reattach(ctx context.Context, recovered map[cproto.ID]aproto.ContainerReattachAck) error {
+	p.mu.Lock()
+	drivers := make([]Driver, 0, len(p.drivers))
+	for _, d := range p.drivers {
+		drivers = append(drivers, d)
+	}
+	p.mu.Unlock()
+
+	for _, d := range drivers {
+		if err := d.Reattach(ctx, recovered); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Pool) driver(id string) (Driver, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	d, ok := p.drivers[id]
+	return d, ok
+}
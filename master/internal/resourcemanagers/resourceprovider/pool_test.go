@@ -0,0 +1,123 @@
+package resourceprovider
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/determined-ai/determined/master/pkg/aproto"
+	"github.com/determined-ai/determined/master/pkg/cproto"
+	"github.com/determined-ai/determined/master/pkg/device"
+	"github.com/determined-ai/determined/master/pkg/model"
+)
+
+// fakeSnapshot and fakeDriver stand in for two distinct backends (e.g. container-agent and
+// k8s-pod) so Pool can be exercised without importing either real implementation.
+type fakeSnapshot struct {
+	driverType string
+	slots      int
+}
+
+func (s fakeSnapshot) DriverType() string { return s.driverType }
+
+type fakeDriver struct {
+	driverType string
+	slots      int
+	started    bool
+	stopped    bool
+}
+
+func (d *fakeDriver) Start(ctx context.Context) error { d.started = true; return nil }
+func (d *fakeDriver) Stop(ctx context.Context) error  { d.stopped = true; return nil }
+
+func (d *fakeDriver) AllocateResources(
+	ctx context.Context, slots int, id cproto.ID,
+) ([]device.Device, error) {
+	devices := make([]device.Device, slots)
+	return devices, nil
+}
+
+func (d *fakeDriver) DeallocateResources(ctx context.Context, id cproto.ID) error { return nil }
+
+func (d *fakeDriver) SlotsSummary(ctx context.Context) model.SlotsSummary {
+	summary := make(model.SlotsSummary, d.slots)
+	for i := 0; i < d.slots; i++ {
+		summary[fmt.Sprintf("%s/slot/%d", d.driverType, i)] = model.SlotSummary{}
+	}
+	return summary
+}
+
+func (d *fakeDriver) Snapshot(ctx context.Context) (DriverSnapshot, error) {
+	return fakeSnapshot{driverType: d.driverType, slots: d.slots}, nil
+}
+
+func (d *fakeDriver) Restore(ctx context.Context, snapshot DriverSnapshot) error {
+	s, ok := snapshot.(fakeSnapshot)
+	if !ok {
+		return errNotFakeSnapshot
+	}
+	d.driverType = s.driverType
+	d.slots = s.slots
+	return nil
+}
+
+func (d *fakeDriver) Reattach(
+	ctx context.Context, recovered map[cproto.ID]aproto.ContainerReattachAck,
+) error {
+	return nil
+}
+
+var errNotFakeSnapshot = fmt.Errorf("not a fakeSnapshot")
+
+func TestPoolDispatchesThroughDriverInterface(t *testing.T) {
+	pool := NewPool()
+	ctx := context.Background()
+
+	a := &fakeDriver{driverType: "fake-a", slots: 2}
+	b := &fakeDriver{driverType: "fake-b", slots: 1}
+
+	require.NoError(t, pool.Add(ctx, "driver-a", a))
+	require.NoError(t, pool.Add(ctx, "driver-b", b))
+	require.True(t, a.started)
+	require.True(t, b.started)
+
+	devices, err := pool.AllocateResources(ctx, "driver-a", 2, cproto.ID("c1"))
+	require.NoError(t, err)
+	require.Len(t, devices, 2)
+
+	require.Len(t, pool.SlotsSummary(ctx), 3, "pool should merge slots reported by every driver")
+
+	require.NoError(t, pool.Remove(ctx, "driver-b"))
+	require.True(t, b.stopped)
+}
+
+func TestPoolRestoresMultipleDriverTypesIntoOnePool(t *testing.T) {
+	pool := NewPool()
+	ctx := context.Background()
+
+	pool.RegisterFactory("fake-a", func(ctx context.Context, snapshot DriverSnapshot) (Driver, error) {
+		return &fakeDriver{}, nil
+	})
+	pool.RegisterFactory("fake-b", func(ctx context.Context, snapshot DriverSnapshot) (Driver, error) {
+		return &fakeDriver{}, nil
+	})
+
+	err := pool.Restore(ctx, map[string]DriverSnapshot{
+		"driver-a": fakeSnapshot{driverType: "fake-a", slots: 2},
+		"driver-b": fakeSnapshot{driverType: "fake-b", slots: 1},
+	})
+	require.NoError(t, err)
+
+	require.Len(t, pool.SlotsSummary(ctx), 3,
+		"both driver types should have been restored and coexist in the same pool")
+}
+
+func TestPoolRestoreRejectsUnregisteredDriverType(t *testing.T) {
+	pool := NewPool()
+	err := pool.Restore(context.Background(), map[string]DriverSnapshot{
+		"driver-a": fakeSnapshot{driverType: "unregistered"},
+	})
+	require.Error(t, err)
+}